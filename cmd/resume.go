@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"ngoperf/pkg/myhttp"
+	"os"
+)
+
+// resumeFile is the output file of get --resume, the body is appended to it
+// if the server sends the missing range, and replaces it if the server sends the whole file
+type resumeFile struct {
+	*os.File
+	offset int64
+}
+
+func openResume(name string) (*resumeFile, error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &resumeFile{File: file, offset: info.Size()}, nil
+}
+
+// OpenBody implements myhttp.BodyOpener
+func (rf *resumeFile) OpenBody(r *myhttp.Response) (io.Writer, error) {
+	switch r.StatusCode {
+	case 206:
+		cr, err := myhttp.ParseContentRange(r.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+		if cr.Start != rf.offset {
+			return nil, errors.New("Cannot resume, the server sent " + cr.String() + fmt.Sprintf(" for a file of %d bytes", rf.offset))
+		}
+		fmt.Printf("Resuming at byte %d\n", rf.offset)
+		_, err = rf.Seek(rf.offset, io.SeekStart)
+		return rf.File, err
+	case 200:
+		if rf.offset > 0 {
+			fmt.Println("The server sent the whole file, downloading it again")
+		}
+		if err := rf.Truncate(0); err != nil {
+			return nil, err
+		}
+		_, err := rf.Seek(0, io.SeekStart)
+		return rf.File, err
+	case 416:
+		if cr, err := myhttp.ParseContentRange(r.Header.Get("Content-Range")); err == nil && cr.Size == rf.offset {
+			fmt.Println("The file is already complete")
+		}
+	}
+	// error bodies are not written to the file
+	return ioutil.Discard, nil
+}
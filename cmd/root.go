@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"ngoperf/pkg/myhttp"
 	"ngoperf/pkg/profile"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -11,11 +16,69 @@ import (
 var (
 	cfgFile    string
 	reqURL     string
+	reqURLs    []string
+	urlFile    string
 	numProfile int
 	numWorker  int
 	http10     bool
 	verbose    bool
 	sleepTime  int
+	pipeline   int
+	proxy      string
+	resolve    []string
+	connectTo  []string
+	dnsServer  string
+	spreadIPs  string
+	spreadEach bool
+	ipv4       bool
+	ipv6       bool
+	compareFam bool
+	bindIPs    []string
+	bindRotate string
+	unixSocket string
+	tcpInfo    bool
+	nagle      bool
+	rcvBuf     int
+	sndBuf     int
+	keepAlive  time.Duration
+	linger     int
+	rstClose   bool
+	outFile    string
+	maxBody    int64
+	method     string
+	strict     bool
+	headers    []string
+	data       string
+	expect     bool
+	expectWait time.Duration
+	ranges     string
+	resume     bool
+	revalidate bool
+	cookies    bool
+	cookieFile string
+	saveCookie string
+	cookieJar  string
+	user       string
+	bearer     string
+	awsSigV4   string
+	users      int
+	iterations int
+	dataFeed   string
+	feedMode   string
+	target     string
+	speed      float64
+	logFormat  string
+	logFields  string
+	importOut  string
+	harFilter  string
+	runImport  bool
+	harFile    string
+	saveRun    string
+	outFormat  string
+	alpha      float64
+	threshold  float64
+	successMin float64
+	resamples  int
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -35,8 +98,45 @@ var profileCmd = &cobra.Command{
 The number of request and number of workers to send request could be set with -u and -v options, see below for details`,
 
 	Run: func(cmd *cobra.Command, args []string) {
-		profiler := profile.NewProfiler(numProfile, numWorker, verbose, http10, sleepTime)
-		profiler.RunProfile(reqURL)
+		if bindRotate != "worker" && bindRotate != "request" {
+			exitOnError(errors.New("Invalid bind-rotate, want worker or request: " + bindRotate))
+		}
+		opts := requestOptions(cmd)
+		opts.NumRequest = numProfile
+		opts.NumWorker = numWorker
+		opts.SleepTime = sleepTime
+		opts.Pipeline = pipeline
+		opts.SpreadIPs = spreadIPs
+		opts.SpreadPerRequest = spreadEach
+		opts.CompareFamilies = compareFam
+		opts.BindIPs = bindIPs
+		opts.BindPerRequest = bindRotate == "request"
+		opts.Revalidate = revalidate
+		if cookieJar != "worker" && cookieJar != "shared" {
+			exitOnError(errors.New("Invalid cookie-jar, want worker or shared: " + cookieJar))
+		}
+		opts.SharedCookies = cookieJar == "shared"
+		opts.Feed = loadFeed()
+		opts.Save = saveRun
+		var targets []profile.Target
+		for _, u := range reqURLs {
+			targets = append(targets, profile.Target{URL: u, Weight: 1})
+		}
+		if urlFile != "" {
+			fileTargets, err := profile.LoadTargets(urlFile)
+			exitOnError(err)
+			targets = append(targets, fileTargets...)
+		}
+		if len(targets) == 0 {
+			exitOnError(errors.New("No url to profile, set -u or --url-file"))
+		}
+		opts.Verbose = verbose
+		client := newClient()
+		// -v only adds the range mismatch details, the headers of every request are not printed
+		client.Verbose = false
+		profiler := profile.NewProfiler(client, opts)
+		profiler.RunTargets(targets)
+		saveCookies(client.Jar)
 	},
 	Example: "ngoperf profile -u=www.google.com -p=2000 -w=400",
 }
@@ -47,12 +147,351 @@ var getCmd = &cobra.Command{
 	Long: `Send HTTP GET to a url and print the response
 The get command print HTTP response body only by default. To print request and response header, add the -v option.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		profiler := profile.NewGetter(http10, verbose)
+		client := newClient()
+		client.MaxBody = maxBody
+		opts := requestOptions(cmd)
+		opts.HAR = harFile
+		if resume {
+			if outFile == "" {
+				exitOnError(errors.New("--resume needs the file to resume with -o"))
+			}
+			if len(opts.Ranges) > 0 {
+				exitOnError(errors.New("--resume cannot be used with --range"))
+			}
+			file, err := openResume(outFile)
+			exitOnError(err)
+			defer file.Close()
+			client.Body = file
+			if file.offset > 0 {
+				opts.Ranges = []myhttp.ByteRange{{Start: file.offset, End: -1}}
+			}
+		} else if outFile != "" {
+			file, err := os.Create(outFile)
+			exitOnError(err)
+			defer file.Close()
+			client.Body = file
+		}
+		profiler := profile.NewGetter(client, opts)
 		profiler.RunProfile(reqURL)
+		saveCookies(client.Jar)
 	},
 	Example: "ngoperf get -vz -u http://hi.wanghy917.workers.dev/links",
 }
 
+var runCmd = &cobra.Command{
+	Use:   "run scenario.yaml",
+	Short: "Run a YAML or JSON scenario of multi-step user flows, and output summary by step and iteration",
+	Long: `Run a YAML or JSON scenario of multi-step user flows, and output summary by step and iteration
+Each virtual user runs the steps of the scenario in turn with its own cookies and variables,
+the values captured from the responses replace the {{name}} placeholders of the next steps`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sc, err := profile.LoadScenario(args[0])
+		exitOnError(err)
+		if cmd.Flags().Changed("users") {
+			sc.Users = users
+		}
+		if cmd.Flags().Changed("iterations") {
+			sc.Iterations = iterations
+		}
+		if sc.Users <= 0 || sc.Iterations <= 0 {
+			exitOnError(errors.New("--users and --iterations must be positive"))
+		}
+		opts := requestOptions(cmd)
+		opts.Feed = loadFeed()
+		client := newClient()
+		profiler := profile.NewProfiler(client, opts)
+		profiler.RunScenario(sc)
+		saveCookies(client.Jar)
+	},
+	Example: "ngoperf run checkout.yaml --users 20 --iterations 5",
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay access.log",
+	Short: "Replay the requests of an access log against a host with their original timing, and output summary about status, time and size",
+	Long: `Replay the requests of an access log against a host with their original timing, and output summary about status, time and size
+The log is in the nginx and Apache combined log format, or JSON lines with the keys set by --fields.
+The requests are sent to --target at the times of the log relative to its first request, divided by --speed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if speed < 0 {
+			exitOnError(errors.New("--speed must not be negative"))
+		}
+		if numWorker <= 0 {
+			exitOnError(errors.New("--nw must be positive"))
+		}
+		fields, err := profile.ParseLogFields(logFields)
+		exitOnError(err)
+		entries, skipped, err := profile.LoadLog(args[0], logFormat, fields)
+		exitOnError(err)
+		if skipped > 0 {
+			fmt.Printf("Skipped %d lines that could not be parsed\n", skipped)
+		}
+		opts := requestOptions(cmd)
+		opts.NumWorker = numWorker
+		client := newClient()
+		profiler := profile.NewProfiler(client, opts)
+		profiler.RunReplay(entries, target, speed)
+	},
+	Example: "ngoperf replay access.log --target http://staging.example.com:8080 --speed 2",
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Turn the requests of a HAR file or a curl command into a scenario, or profile them",
+	Long: `Turn the requests of a HAR file or a curl command into a scenario for the run command, or profile them
+The scenario is printed in YAML unless -o is set. With --profile, the requests are profiled instead,
+spread over by the repeat of their steps like the urls of the profile command.`,
+}
+
+var importHARCmd = &cobra.Command{
+	Use:   "har file.har",
+	Short: "Import the requests of a HAR file, with the times between them as think times",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var filter *regexp.Regexp
+		if harFilter != "" {
+			var err error
+			filter, err = regexp.Compile(harFilter)
+			exitOnError(err)
+		}
+		sc, err := profile.ImportHAR(args[0], filter)
+		exitOnError(err)
+		importScenario(cmd, sc)
+	},
+	Example: `ngoperf import har session.har --filter '^https://api\.example\.com/' -o session.yaml
+ngoperf run session.yaml --users 10`,
+}
+
+var importCurlCmd = &cobra.Command{
+	Use:   "curl 'curl ...'",
+	Short: "Import the request of a curl command, given as one quoted argument or after --",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		sc, err := profile.ParseCurl(args)
+		exitOnError(err)
+		importScenario(cmd, sc)
+	},
+	Example: `ngoperf import curl 'curl -X POST https://example.com/api -H "Content-Type: application/json" -d "{\"a\":1}"'
+ngoperf import curl --profile -p 500 -w 20 -- curl https://example.com/ -H 'Accept: text/html'`,
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report run.ngp",
+	Short: "Print the summary of a run saved by profile --save, or export its requests",
+	Long: `Print the summary of a run saved by profile --save, or export its requests
+The table format prints the same summary as the profile command, with the time, host and command of the run.
+The csv and json formats print every request with its status, times, sizes and addresses.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		run, err := profile.LoadRun(args[0])
+		exitOnError(err)
+		exitOnError(run.Report(outFormat))
+	},
+	Example: `ngoperf profile -u www.google.com -p 2000 -w 400 --save google.ngp
+ngoperf report google.ngp --format csv > google.csv`,
+}
+
+// exitRegression is the exit code of compare when b regressed
+const exitRegression = 2
+
+var compareCmd = &cobra.Command{
+	Use:   "compare a.ngp b.ngp",
+	Short: "Compare two runs saved by profile --save, and exit with code 2 if the second one regressed",
+	Long: `Compare two runs saved by profile --save, and exit with code 2 if the second one regressed
+ngoperf prints the deltas of the time to first byte percentiles, the success rate and the errors by class from a to b.
+The time to first byte distributions are compared with the Mann-Whitney U test, and the percentile deltas get bootstrap
+confidence intervals. b regressed when its median or p95 is significantly slower by --threshold percent or more,
+or when its success rate is significantly lower by --success-threshold points or more.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if alpha <= 0 || alpha >= 1 {
+			exitOnError(errors.New("--alpha must be between 0 and 1"))
+		}
+		if resamples < 100 {
+			exitOnError(errors.New("--resamples must be at least 100"))
+		}
+		a, err := profile.LoadRun(args[0])
+		exitOnError(err)
+		b, err := profile.LoadRun(args[1])
+		exitOnError(err)
+		regressions, err := profile.CompareRuns(a, b, profile.CompareOptions{
+			Alpha:            alpha,
+			Threshold:        threshold,
+			SuccessThreshold: successMin,
+			Resamples:        resamples,
+		})
+		exitOnError(err)
+		if len(regressions) > 0 {
+			os.Exit(exitRegression)
+		}
+	},
+	Example: `ngoperf profile -u api.example.com -p 2000 -w 20 --save before.ngp
+ngoperf profile -u api.example.com -p 2000 -w 20 --save after.ngp
+ngoperf compare before.ngp after.ngp --threshold 10 || echo "regression"`,
+}
+
+// importScenario saves the imported scenario, or profiles its steps with --profile
+func importScenario(cmd *cobra.Command, sc *profile.Scenario) {
+	if !runImport {
+		out := importOut
+		if out == "" {
+			out = "-"
+		}
+		exitOnError(sc.Save(out))
+		return
+	}
+	opts := requestOptions(cmd)
+	opts.NumRequest = numProfile
+	opts.NumWorker = numWorker
+	opts.SleepTime = sleepTime
+	client := newClient()
+	profiler := profile.NewProfiler(client, opts)
+	profiler.RunTargets(sc.Targets())
+}
+
+// newClient returns the myhttp.Client set by the flags
+func newClient() myhttp.Client {
+	resolveMap, err := myhttp.ParseResolve(resolve)
+	exitOnError(err)
+	connectToMap, err := myhttp.ParseConnectTo(connectTo)
+	exitOnError(err)
+	localIP := ""
+	if len(bindIPs) > 0 {
+		localIP = bindIPs[0]
+	}
+	if ipv4 && ipv6 {
+		exitOnError(errors.New("-4 cannot be used with -6"))
+	}
+	network := "tcp"
+	if ipv4 {
+		network = "tcp4"
+	} else if ipv6 {
+		network = "tcp6"
+	}
+	var jar *myhttp.CookieJar
+	if cookies || cookieFile != "" || saveCookie != "" {
+		jar = myhttp.NewCookieJar()
+		if cookieFile != "" {
+			exitOnError(jar.LoadFile(cookieFile))
+		}
+	}
+	var username, password string
+	if user != "" {
+		i := strings.IndexByte(user, ':')
+		if i < 0 {
+			exitOnError(errors.New("Invalid user, want user:password: " + user))
+		}
+		username, password = user[:i], user[i+1:]
+	}
+	var signer myhttp.Signer
+	if awsSigV4 != "" {
+		signer = newAWSSigner(username, password)
+		username, password = "", ""
+	}
+	return myhttp.Client{
+		HTTP10:          http10,
+		Verbose:         verbose,
+		Proxy:           proxy,
+		Resolve:         resolveMap,
+		ConnectTo:       connectToMap,
+		DNSServer:       dnsServer,
+		Network:         network,
+		LocalIP:         localIP,
+		UnixSocket:      unixSocket,
+		TCPInfo:         tcpInfo,
+		Nagle:           nagle,
+		ReadBuffer:      rcvBuf,
+		WriteBuffer:     sndBuf,
+		KeepAlive:       keepAlive,
+		Linger:          linger,
+		ResetOnClose:    rstClose,
+		Strict:          strict,
+		Username:        username,
+		Password:        password,
+		BearerToken:     bearer,
+		Signer:          signer,
+		Jar:             jar,
+		ExpectContinue:  expect,
+		ContinueTimeout: expectWait,
+	}
+}
+
+// requestOptions returns the profile.Options of the request set by the flags
+// The method is POST by default when a body is sent
+func requestOptions(cmd *cobra.Command) profile.Options {
+	opts := profile.Options{Method: strings.ToUpper(method)}
+	for _, line := range headers {
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			exitOnError(errors.New("Invalid header, want name: value: " + line))
+		}
+		opts.Header.Add(strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]))
+	}
+	if data != "" {
+		opts.Body = []byte(data)
+		if strings.HasPrefix(data, "@") {
+			// streamed from the file by each request
+			_, err := os.Stat(data[1:])
+			exitOnError(err)
+			opts.Body, opts.BodyFile = nil, data[1:]
+		}
+		if !cmd.Flags().Changed("method") {
+			opts.Method = "POST"
+		}
+	}
+	if ranges != "" {
+		var err error
+		opts.Ranges, err = myhttp.ParseRanges(ranges)
+		exitOnError(err)
+	}
+	return opts
+}
+
+// newAWSSigner returns the signer for --aws-sigv4 region:service with the access and secret keys
+// of --user, or of AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY if --user is not set
+func newAWSSigner(accessKey, secretKey string) *myhttp.AWSSigner {
+	parts := strings.Split(awsSigV4, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		exitOnError(errors.New("Invalid aws-sigv4, want region:service: " + awsSigV4))
+	}
+	signer := &myhttp.AWSSigner{AccessKey: accessKey, SecretKey: secretKey, Region: parts[0], Service: parts[1]}
+	if accessKey == "" {
+		signer.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		signer.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		signer.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if signer.AccessKey == "" || signer.SecretKey == "" {
+		exitOnError(errors.New("No AWS credentials, set --user or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY"))
+	}
+	return signer
+}
+
+// loadFeed returns the --data-feed feed, nil if it is not set
+func loadFeed() *profile.Feed {
+	if dataFeed == "" {
+		return nil
+	}
+	feed, err := profile.LoadFeed(dataFeed, feedMode)
+	exitOnError(err)
+	return feed
+}
+
+// saveCookies writes the jar to the --save-cookies file if it is set
+func saveCookies(jar *myhttp.CookieJar) {
+	if saveCookie != "" {
+		exitOnError(jar.SaveFile(saveCookie))
+	}
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -62,19 +501,136 @@ func Execute() {
 	}
 }
 
+const proxyUsage = "proxy url, http://[user:pass@]host:port, https://, socks5:// or socks5h://\nngoperf use HTTPS_PROXY, HTTP_PROXY, ALL_PROXY and NO_PROXY if not set"
+
+func addRequestFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&headers, "header", "H", nil, "name: value, header field to send, replaces the default one of the same name, can be repeated")
+	cmd.Flags().StringVarP(&data, "data", "d", "", "request body, @file to stream it from the file\nthe method is POST unless -X is set")
+	cmd.Flags().BoolVar(&expect, "expect-continue", false, "send the body with Expect: 100-continue and wait for 100 Continue before sending it\nthe body is not sent if a final response comes first, pipelined requests are sent without it")
+	cmd.Flags().StringVar(&ranges, "range", "", "first-last[,first-last...], byte ranges to request, first- or -suffix for open ranges\nngoperf checks the 206 responses, including multipart/byteranges, against the ranges")
+	cmd.Flags().StringVar(&user, "user", "", "user:password, sent with Basic authentication, or with Digest when a 401 response challenges it\nthe access and secret keys with --aws-sigv4")
+	cmd.Flags().StringVar(&bearer, "bearer", "", "token sent in Authorization: Bearer")
+	cmd.Flags().StringVar(&awsSigV4, "aws-sigv4", "", "region:service, sign each request with AWS Signature Version 4\nthe keys are taken from --user or AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN")
+	cmd.Flags().BoolVar(&cookies, "cookies", false, "store the cookies of the responses and send them with the requests, RFC 6265")
+	cmd.Flags().StringVarP(&cookieFile, "cookie-file", "b", "", "load the cookies from a Netscape format cookie file, as written by curl -c, implies --cookies")
+	cmd.Flags().StringVarP(&saveCookie, "save-cookies", "c", "", "save the cookies to a Netscape format cookie file after the requests, implies --cookies")
+	cmd.Flags().DurationVar(&expectWait, "continue-timeout", time.Second, "max time to wait for 100 Continue before sending the body anyway")
+}
+
+func addFeedFlags(cmd *cobra.Command, usage string) {
+	cmd.Flags().StringVar(&dataFeed, "data-feed", "", "CSV file with a header row, or JSON lines file ending with .jsonl, of values to fill the requests with\n"+usage)
+	cmd.Flags().StringVar(&feedMode, "feed-mode", profile.FeedSequential, "sequential, random or unique, take the rows in turn, at random, or each row once")
+}
+
+func addConnectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&resolve, "resolve", nil, "host:port:addr, connect to addr for host and port instead of resolving host\nhost and port can be *, can be repeated")
+	cmd.Flags().StringArrayVar(&connectTo, "connect-to", nil, "host1:port1:host2:port2, connect to host2:port2 for requests to host1:port1\nHost header and SNI are kept, can be repeated")
+	cmd.Flags().StringVar(&dnsServer, "dns-server", "", "ip[:port] of the DNS server to resolve hosts with instead of the system resolver")
+	cmd.Flags().BoolVarP(&ipv4, "ipv4", "4", false, "connect over IPv4 only")
+	cmd.Flags().BoolVarP(&ipv6, "ipv6", "6", false, "connect over IPv6 only")
+	cmd.Flags().StringSliceVar(&bindIPs, "bind", nil, "ip[,ip...], local source addresses to bind the connections to")
+	cmd.Flags().BoolVar(&nagle, "nagle", false, "enable Nagle's algorithm by clearing TCP_NODELAY, which is set by default")
+	cmd.Flags().IntVar(&rcvBuf, "rcvbuf", 0, "SO_RCVBUF socket receive buffer size in bytes, 0 for the system default")
+	cmd.Flags().IntVar(&sndBuf, "sndbuf", 0, "SO_SNDBUF socket send buffer size in bytes, 0 for the system default")
+	cmd.Flags().DurationVar(&keepAlive, "keepalive", 0, "TCP keepalive period, 0 for the default 15s and negative to disable keepalive")
+	cmd.Flags().IntVar(&linger, "linger", 0, "SO_LINGER timeout in seconds for closing the connection, 0 to leave it unset")
+	cmd.Flags().BoolVar(&rstClose, "rst-close", false, "set SO_LINGER to 0 so closing the connection sends a RST instead of a FIN")
+	cmd.Flags().StringVar(&unixSocket, "unix-socket", "", "path of a Unix domain socket to send the requests over\nthe url gives the Host header and path, ngoperf use plain HTTP unless the url starts with https://")
+}
+
 func init() {
 	profileCmd.Flags().BoolVarP(&http10, "http10", "z", false, "use HTTP/1.0 to request\nnhoprtg use HTTP/1.1 by default")
-	profileCmd.Flags().StringVarP(&reqURL, "url", "u", "", "request url\nngoperf use https with port 443 to connect if protocol and port are not included")
-	profileCmd.MarkFlagRequired("url")
+	profileCmd.Flags().StringArrayVarP(&reqURLs, "url", "u", nil, "request url, can be repeated to spread the requests evenly over the urls\nngoperf use https with port 443 to connect if protocol and port are not included")
+	profileCmd.Flags().StringVar(&urlFile, "url-file", "", "file with one \"[METHOD] url [weight]\" per line, the requests are spread over the urls by weight\nngoperf reports the results of each url and the total")
+	profileCmd.Flags().StringVarP(&method, "method", "X", "GET", "request method, e.g. HEAD")
+	addRequestFlags(profileCmd)
+	profileCmd.Flags().BoolVar(&strict, "strict", false, "check the responses against RFC 9110 and RFC 9112\nngoperf reports the counts of protocol violations by rule")
+	profileCmd.Flags().StringVarP(&proxy, "proxy", "x", "", proxyUsage)
+	addConnectionFlags(profileCmd)
+	profileCmd.Flags().StringVar(&spreadIPs, "spread-ips", "", "rr or random, spread the requests over all the addresses of the host in turn or at random\nngoperf reports the success rate, time to first byte and errors by remote ip")
+	profileCmd.Flags().BoolVar(&tcpInfo, "tcp-info", false, "read TCP_INFO from the socket after each request, Linux only\nngoperf reports the distributions of smoothed rtt, rtt variance, retransmits and congestion window")
+	profileCmd.Flags().StringVar(&bindRotate, "bind-rotate", "worker", "worker or request, rotate the --bind addresses per worker or per request\nngoperf reports the success rate, time to first byte and errors by source ip")
+	profileCmd.Flags().BoolVar(&compareFam, "compare-families", false, "alternate the requests over IPv4 and IPv6\nngoperf reports the time to first byte of both address families side by side")
+	profileCmd.Flags().BoolVar(&revalidate, "revalidate", false, "send one full request, then send If-None-Match and If-Modified-Since with its ETag and Last-Modified\nngoperf reports the 304 ratio and the time to first byte of 304 against 200 responses")
+	addFeedFlags(profileCmd, "{{column}} in the url, headers and body of each request is replaced by the value of one row")
+	profileCmd.Flags().StringVar(&cookieJar, "cookie-jar", "worker", "worker or shared, give each worker its own cookie jar or share one between them")
+	profileCmd.Flags().BoolVar(&spreadEach, "spread-resolve-each", false, "resolve the host before each request instead of once for --spread-ips")
+	profileCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "print the details of the range mismatches, which are counted by kind otherwise")
 	profileCmd.Flags().IntVarP(&numProfile, "np", "p", 100, "num of request")
 	profileCmd.Flags().IntVarP(&numWorker, "nw", "w", 5, "num of worker")
 	profileCmd.Flags().IntVarP(&sleepTime, "sleep", "s", 0, "sleep time between requests\nngoperf randomly sleep 0 to s seconds between the requests")
+	profileCmd.Flags().IntVar(&pipeline, "pipeline", 1, "num of requests each worker writes on one connection before reading the responses\nngoperf reports the time to first byte by position in the pipeline")
+	profileCmd.Flags().StringVar(&saveRun, "save", "", "save the run with the record of every request to a file, e.g. run.ngp\nngoperf report prints its summary again or exports the requests")
 	rootCmd.AddCommand(profileCmd)
 
 	getCmd.Flags().BoolVarP(&http10, "http10", "z", false, "use HTTP/1.0 to request\nnhoprtg use HTTP/1.1 by default")
 	getCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "print request and response header")
+	getCmd.Flags().BoolVar(&tcpInfo, "tcp-info", false, "print TCP_INFO of the socket after the request with -v, Linux only")
 	getCmd.Flags().StringVarP(&reqURL, "url", "u", "", "request url\nngoperf use https with port 443 to connect if protocol and port are not included")
 	getCmd.MarkFlagRequired("url")
+	getCmd.Flags().StringVarP(&method, "method", "X", "GET", "request method, e.g. HEAD")
+	addRequestFlags(getCmd)
+	getCmd.Flags().BoolVar(&strict, "strict", false, "check the response against RFC 9110 and RFC 9112 and print the protocol violations")
+	getCmd.Flags().StringVarP(&outFile, "output", "o", "", "write the response body to the file instead of printing it")
+	getCmd.Flags().StringVar(&harFile, "har", "", "write the request and the response to a HAR 1.2 file, with the full header, body, phase timings, server ip and TLS details")
+	getCmd.Flags().BoolVar(&resume, "resume", false, "continue a partial download of the -o file by requesting the bytes after its end")
+	getCmd.Flags().Int64Var(&maxBody, "max-body", 0, "max num of body bytes to print or write, the rest is read and discarded\n0 for no limit")
+	getCmd.Flags().StringVarP(&proxy, "proxy", "x", "", proxyUsage)
+	addConnectionFlags(getCmd)
 
 	rootCmd.AddCommand(getCmd)
+
+	replayCmd.Flags().StringVarP(&target, "target", "t", "", "scheme://host[:port] to send the requests to, the paths and queries are taken from the log\nngoperf use https with port 443 to connect if protocol and port are not included")
+	replayCmd.MarkFlagRequired("target")
+	replayCmd.Flags().Float64Var(&speed, "speed", 1, "divide the times between the requests by speed, 2 replays twice as fast\n0 sends the requests as fast as --nw allows")
+	replayCmd.Flags().StringVar(&logFormat, "format", "auto", "auto, combined or json, auto reads the lines starting with { as JSON and the others as combined log format")
+	replayCmd.Flags().StringVar(&logFields, "fields", "", "field=key[,field=key...], keys of the JSON log lines, dot paths can be used\nthe fields are time, method, path, request, status, user_agent and referer, each defaults to its own name")
+	replayCmd.Flags().IntVarP(&numWorker, "nw", "w", 50, "max num of requests in flight, the requests are sent late when all of them are busy\nngoperf reports how late the requests were sent")
+	replayCmd.Flags().BoolVarP(&http10, "http10", "z", false, "use HTTP/1.0 to request\nnhoprtg use HTTP/1.1 by default")
+	replayCmd.Flags().StringArrayVarP(&headers, "header", "H", nil, "name: value, header field to send with every request, replaces the User-Agent and Referer of the log, can be repeated")
+	replayCmd.Flags().StringVar(&user, "user", "", "user:password, sent with Basic authentication, or with Digest when a 401 response challenges it")
+	replayCmd.Flags().StringVar(&bearer, "bearer", "", "token sent in Authorization: Bearer")
+	replayCmd.Flags().BoolVar(&strict, "strict", false, "check the responses against RFC 9110 and RFC 9112\nngoperf reports the counts of protocol violations by rule")
+	replayCmd.Flags().StringVarP(&proxy, "proxy", "x", "", proxyUsage)
+	addConnectionFlags(replayCmd)
+	rootCmd.AddCommand(replayCmd)
+
+	for _, cmd := range []*cobra.Command{importHARCmd, importCurlCmd} {
+		cmd.Flags().StringVarP(&importOut, "output", "o", "", "write the scenario to the file instead of printing it")
+		cmd.Flags().BoolVar(&runImport, "profile", false, "profile the requests instead of writing the scenario\nngoperf reports the results of each request and the total")
+		cmd.Flags().IntVarP(&numProfile, "np", "p", 100, "num of request with --profile")
+		cmd.Flags().IntVarP(&numWorker, "nw", "w", 5, "num of worker with --profile")
+		cmd.Flags().IntVarP(&sleepTime, "sleep", "s", 0, "sleep time between requests with --profile\nngoperf randomly sleep 0 to s seconds between the requests")
+		cmd.Flags().BoolVarP(&http10, "http10", "z", false, "use HTTP/1.0 to request\nnhoprtg use HTTP/1.1 by default")
+		cmd.Flags().BoolVar(&strict, "strict", false, "check the responses against RFC 9110 and RFC 9112\nngoperf reports the counts of protocol violations by rule")
+		cmd.Flags().StringVarP(&proxy, "proxy", "x", "", proxyUsage)
+		addConnectionFlags(cmd)
+		importCmd.AddCommand(cmd)
+	}
+	importHARCmd.Flags().StringVar(&harFilter, "filter", "", "regular expression, import only the requests whose url matches it")
+	rootCmd.AddCommand(importCmd)
+
+	runCmd.Flags().IntVar(&users, "users", 1, "num of virtual users running the scenario at the same time, overrides users of the scenario")
+	runCmd.Flags().IntVar(&iterations, "iterations", 1, "num of times each user runs the steps, overrides iterations of the scenario")
+	runCmd.Flags().BoolVarP(&http10, "http10", "z", false, "use HTTP/1.0 to request\nnhoprtg use HTTP/1.1 by default")
+	runCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "print the requests, response headers and captured values")
+	runCmd.Flags().StringArrayVarP(&headers, "header", "H", nil, "name: value, header field to send with every step, the headers of a step replace it, can be repeated")
+	runCmd.Flags().StringVar(&user, "user", "", "user:password, sent with Basic authentication, or with Digest when a 401 response challenges it")
+	runCmd.Flags().StringVar(&bearer, "bearer", "", "token sent in Authorization: Bearer")
+	runCmd.Flags().StringVarP(&cookieFile, "cookie-file", "b", "", "load the cookies every user starts with from a Netscape format cookie file")
+	runCmd.Flags().StringVarP(&saveCookie, "save-cookies", "c", "", "save the cookies of all the users to a Netscape format cookie file after the run")
+	addFeedFlags(runCmd, "each iteration takes one row, its columns are set as variables of the user")
+	runCmd.Flags().BoolVar(&strict, "strict", false, "check the responses against RFC 9110 and RFC 9112\nngoperf reports the counts of protocol violations by rule")
+	runCmd.Flags().StringVarP(&proxy, "proxy", "x", "", proxyUsage)
+	addConnectionFlags(runCmd)
+	rootCmd.AddCommand(runCmd)
+
+	reportCmd.Flags().StringVar(&outFormat, "format", "table", "table, csv or json, print the summary tables of the run, or every request as CSV or JSON")
+	rootCmd.AddCommand(reportCmd)
+
+	compareCmd.Flags().Float64Var(&alpha, "alpha", 0.05, "significance level of the tests, the confidence intervals are at 1-alpha")
+	compareCmd.Flags().Float64Var(&threshold, "threshold", 5, "min slowdown in percent of the median or p95 time to first byte counted as a regression")
+	compareCmd.Flags().Float64Var(&successMin, "success-threshold", 1, "min drop in points of the success rate counted as a regression")
+	compareCmd.Flags().IntVar(&resamples, "resamples", 1000, "num of bootstrap resamples of the confidence intervals")
+	rootCmd.AddCommand(compareCmd)
 }
@@ -6,5 +6,7 @@ require (
 	github.com/cheggaaa/pb/v3 v3.0.5
 	github.com/olekukonko/tablewriter v0.0.4
 	github.com/spf13/cobra v1.1.1
+	golang.org/x/sys v0.0.0-20200116001909-b77594299b42
 	golang.org/x/text v0.3.3
+	gopkg.in/yaml.v2 v2.4.0
 )
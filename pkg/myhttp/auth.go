@@ -0,0 +1,219 @@
+package myhttp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// Signer adds authentication fields to each request, after all the other fields are set
+// It is called again for every request, so signatures are never reused
+type Signer interface {
+	Sign(r *SignRequest) error
+}
+
+// SignRequest is the request given to a Signer, the fields it adds to Header are sent
+type SignRequest struct {
+	Method string
+	// URL has the scheme, host, path and query of the request as sent
+	URL    *url.URL
+	Header *Header
+	Body   []byte
+	// BodyFile, if set, is the file the body is streamed from, see Request.BodyFile
+	BodyFile string
+}
+
+// authorization returns the Authorization field value for the request from
+// the Digest challenge answered last, or the credentials of the client
+func (client *Client) authorization(r *request, method, target string, req *Request) (string, error) {
+	if client.digest != nil {
+		r.digest = true
+		return client.digest.authorization(client.Username, client.Password, method, target, req)
+	}
+	if client.Username != "" {
+		auth := client.Username + ":" + client.Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth)), nil
+	}
+	if client.BearerToken != "" {
+		return "Bearer " + client.BearerToken, nil
+	}
+	return "", nil
+}
+
+// challenged reports whether the 401 response to r has a Digest challenge to send the request again with
+// The challenge is kept for the next requests of the client
+func (client *Client) challenged(r *request, resp *Response) bool {
+	if client.Username == "" {
+		return false
+	}
+	for _, v := range resp.Header.Values("WWW-Authenticate") {
+		ch := parseDigestChallenge(v)
+		if ch == nil {
+			continue
+		}
+		// a rejected answer to a challenge that is not stale means wrong credentials
+		if r.digest && !ch.stale {
+			return false
+		}
+		if client.Verbose {
+			fmt.Println("Digest challenge for realm " + ch.realm + ", sending the request again")
+		}
+		client.digest = ch
+		return true
+	}
+	return false
+}
+
+// digestChallenge is a Digest challenge of a WWW-Authenticate field, RFC 7616
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+	// nc is the nonce count of the last request answering the challenge
+	nc uint32
+}
+
+// parseDigestChallenge returns the Digest challenge of a WWW-Authenticate value, nil if it has none
+func parseDigestChallenge(v string) *digestChallenge {
+	i := 0
+	for {
+		// a challenge starts with its scheme, at the start of the value or after a comma
+		j := strings.Index(strings.ToLower(v[i:]), "digest ")
+		if j < 0 {
+			return nil
+		}
+		i += j
+		if strings.TrimSpace(v[:i]) == "" || strings.HasSuffix(strings.TrimSpace(v[:i]), ",") {
+			break
+		}
+		i += len("digest ")
+	}
+	params := parseAuthParams(v[i+len("digest "):])
+	if params["nonce"] == "" {
+		return nil
+	}
+	ch := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+		stale:     strings.EqualFold(params["stale"], "true"),
+	}
+	// auth is preferred to auth-int, which needs the body
+	for _, qop := range strings.Split(params["qop"], ",") {
+		qop = strings.TrimSpace(qop)
+		if qop == "auth" || qop == "auth-int" && ch.qop == "" {
+			ch.qop = qop
+		}
+	}
+	return ch
+}
+
+// parseAuthParams parses the comma separated name=value or name="value" parameters of a challenge,
+// up to the next challenge
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.ContainsAny(s[:eq], " \t,") {
+			return params
+		}
+		name := strings.ToLower(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var sb strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				sb.WriteByte(s[i])
+			}
+			value = sb.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[name] = value
+	}
+}
+
+// newCnonce returns the random client nonce of an answer to a challenge
+var newCnonce = func() string {
+	cnonce := make([]byte, 16)
+	rand.Read(cnonce)
+	return hex.EncodeToString(cnonce)
+}
+
+// authorization answers the challenge for a request, RFC 7616 section 3.4
+// It fails if the body of a request answering an auth-int challenge cannot be read
+func (ch *digestChallenge) authorization(username, password, method, uri string, req *Request) (string, error) {
+	algorithm := strings.ToUpper(ch.algorithm)
+	var newHash func() hash.Hash = md5.New
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	cn := newCnonce()
+	nc := fmt.Sprintf("%08x", atomic.AddUint32(&ch.nc, 1))
+
+	ha1 := h(username + ":" + ch.realm + ":" + password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + ch.nonce + ":" + cn)
+	}
+	ha2 := h(method + ":" + uri)
+	if ch.qop == "auth-int" {
+		bodySum, err := bodyHash(newHash, req.Body, req.BodyFile)
+		if err != nil {
+			return "", err
+		}
+		ha2 = h(method + ":" + uri + ":" + bodySum)
+	}
+	response := h(ha1 + ":" + ch.nonce + ":" + ha2)
+	if ch.qop != "" {
+		response = h(ha1 + ":" + ch.nonce + ":" + nc + ":" + cn + ":" + ch.qop + ":" + ha2)
+	}
+
+	fields := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", ch.realm),
+		fmt.Sprintf("nonce=%q", ch.nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if ch.algorithm != "" {
+		fields = append(fields, "algorithm="+ch.algorithm)
+	}
+	fields = append(fields, fmt.Sprintf("response=%q", response))
+	if ch.qop != "" {
+		fields = append(fields, "qop="+ch.qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cn))
+	}
+	if ch.opaque != "" {
+		fields = append(fields, fmt.Sprintf("opaque=%q", ch.opaque))
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
@@ -0,0 +1,97 @@
+package myhttp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDigestChallenge(t *testing.T) {
+	tests := []struct {
+		value string
+		want  *digestChallenge
+	}{
+		{`Basic realm="x"`, nil},
+		{`Digest realm="x"`, nil},
+		{
+			`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+			&digestChallenge{realm: "testrealm@host.com", nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque: "5ccc069c403ebaf9f0171e9517f40e41", qop: "auth"},
+		},
+		{
+			`Basic realm="a, b", Digest realm="r\"q", nonce=n1, algorithm=SHA-256, qop="auth-int", stale=TRUE`,
+			&digestChallenge{realm: `r"q`, nonce: "n1", algorithm: "SHA-256", qop: "auth-int", stale: true},
+		},
+	}
+	for _, tt := range tests {
+		got := parseDigestChallenge(tt.value)
+		if got == nil || tt.want == nil {
+			if got != tt.want {
+				t.Errorf("parseDigestChallenge(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+			continue
+		}
+		if *got != *tt.want {
+			t.Errorf("parseDigestChallenge(%q) = %+v, want %+v", tt.value, *got, *tt.want)
+		}
+	}
+}
+
+// TestDigestResponse checks the answers to the examples of RFC 2617 section 3.5 and RFC 7616 section 3.9.1
+func TestDigestResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		ch       digestChallenge
+		password string
+		cnonce   string
+		want     string
+	}{
+		{
+			name:     "rfc2617",
+			ch:       digestChallenge{realm: "testrealm@host.com", nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque: "5ccc069c403ebaf9f0171e9517f40e41", qop: "auth"},
+			password: "Circle Of Life",
+			cnonce:   "0a4f113b",
+			want:     "6629fae49393a05397450978507c4ef1",
+		},
+		{
+			name:     "rfc7616 MD5",
+			ch:       digestChallenge{realm: "http-auth@example.org", nonce: "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque: "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", algorithm: "MD5", qop: "auth"},
+			password: "Circle of Life",
+			cnonce:   "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+			want:     "8ca523f5e9506fed4657c9700eebdbec",
+		},
+		{
+			name:     "rfc7616 SHA-256",
+			ch:       digestChallenge{realm: "http-auth@example.org", nonce: "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque: "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", algorithm: "SHA-256", qop: "auth"},
+			password: "Circle of Life",
+			cnonce:   "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+			want:     "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+		},
+	}
+	defer func(f func() string) { newCnonce = f }(newCnonce)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newCnonce = func() string { return tt.cnonce }
+			ch := tt.ch
+			got, err := ch.authorization("Mufasa", tt.password, "GET", "/dir/index.html", &Request{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, `response="`+tt.want+`"`) {
+				t.Errorf("authorization = %s, want response %s", got, tt.want)
+			}
+			if !strings.Contains(got, "nc=00000001") || !strings.Contains(got, `cnonce="`+tt.cnonce+`"`) {
+				t.Errorf("authorization = %s, want nc=00000001 and cnonce %s", got, tt.cnonce)
+			}
+			// the nonce count goes up with each answer
+			if got, _ = ch.authorization("Mufasa", tt.password, "GET", "/dir/index.html", &Request{}); !strings.Contains(got, "nc=00000002") {
+				t.Errorf("second authorization = %s, want nc=00000002", got)
+			}
+		})
+	}
+}
+
+func TestDigestBodyError(t *testing.T) {
+	ch := digestChallenge{realm: "r", nonce: "n", qop: "auth-int"}
+	if _, err := ch.authorization("u", "p", "POST", "/", &Request{BodyFile: "/nonexistent/body"}); err == nil {
+		t.Error("authorization of an unreadable auth-int body succeeded")
+	}
+}
@@ -29,21 +29,49 @@ type chunkedReader struct {
 	err      error
 	buf      [2]byte
 	checkEnd bool // whether need to check for \r\n chunk footer
+	// warn, if set, is called with the chunk lines ending with a bare LF
+	warn func(rule, rfc, detail string)
 }
 
 func (cr *chunkedReader) beginChunk() {
 	// chunk-size CRLF
 	var line []byte
-	line, cr.err = readChunkLine(cr.r)
+	var crlf bool
+	line, crlf, cr.err = readChunkLine(cr.r)
 	if cr.err != nil {
 		return
 	}
+	cr.checkLineEnding(line, crlf)
 	cr.n, cr.err = parseHexUint(line)
 	if cr.err != nil {
 		return
 	}
 	if cr.n == 0 {
-		cr.err = io.EOF
+		cr.err = cr.skipTrailer()
+	}
+}
+
+// skipTrailer reads the trailer section up to the empty line ending the message,
+// so the next pipelined response starts right after it
+func (cr *chunkedReader) skipTrailer() error {
+	for {
+		line, crlf, err := readLine(cr.r)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		cr.checkLineEnding(line, crlf)
+		if len(line) == 0 {
+			return io.EOF
+		}
+	}
+}
+
+func (cr *chunkedReader) checkLineEnding(line []byte, crlf bool) {
+	if cr.warn != nil && !crlf {
+		cr.warn(RuleChunkLine, "RFC 9112 section 7.1", "chunk line ends with a bare LF: "+quote(line))
 	}
 }
 
@@ -107,7 +135,8 @@ func (cr *chunkedReader) Read(b []byte) (n int, err error) {
 // Give up if the line exceeds maxLineLength.
 // The returned bytes are owned by the bufio.Reader
 // so they are only valid until the next bufio read.
-func readChunkLine(b *bufio.Reader) ([]byte, error) {
+// crlf reports whether the line ended with \r\n rather than a bare \n.
+func readChunkLine(b *bufio.Reader) ([]byte, bool, error) {
 	p, err := b.ReadSlice('\n')
 	if err != nil {
 		// We always know when EOF is coming.
@@ -117,17 +146,18 @@ func readChunkLine(b *bufio.Reader) ([]byte, error) {
 		} else if err == bufio.ErrBufferFull {
 			err = errors.New("header line too long")
 		}
-		return nil, err
+		return nil, false, err
 	}
 	if len(p) >= maxLineLength {
-		return nil, errors.New("header line too long")
+		return nil, false, errors.New("header line too long")
 	}
+	crlf := len(p) >= 2 && p[len(p)-2] == '\r'
 	p = trimTrailingWhitespace(p)
 	p, err = removeChunkExtension(p)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	return p, nil
+	return p, crlf, nil
 }
 
 func trimTrailingWhitespace(b []byte) []byte {
@@ -0,0 +1,373 @@
+package myhttp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie is a cookie stored in a CookieJar, RFC 6265 section 5.3
+type Cookie struct {
+	Name   string
+	Value  string
+	Domain string
+	Path   string
+	// Expires is zero for a session cookie
+	Expires  time.Time
+	Secure   bool
+	HTTPOnly bool
+	// HostOnly cookies are only sent to Domain, not to its subdomains
+	HostOnly bool
+	created  time.Time
+}
+
+func (c *Cookie) String() string {
+	expires := "session"
+	if !c.Expires.IsZero() {
+		expires = c.Expires.UTC().Format(time.RFC1123)
+	}
+	domain := c.Domain
+	if !c.HostOnly {
+		domain = "." + domain
+	}
+	return fmt.Sprintf("%s=%s (domain %s, path %s, expires %s)", c.Name, c.Value, domain, c.Path, expires)
+}
+
+func (c *Cookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// CookieJar stores the cookies set by the responses and returns the ones to send with a request
+// with the domain, path, expiry and secure matching of RFC 6265. It is safe for concurrent use.
+type CookieJar struct {
+	mu      sync.Mutex
+	cookies map[string]*Cookie
+}
+
+// NewCookieJar returns an empty CookieJar
+func NewCookieJar() *CookieJar {
+	return &CookieJar{cookies: make(map[string]*Cookie)}
+}
+
+func cookieKey(c *Cookie) string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+// Clone returns a jar with a copy of the cookies of j
+func (j *CookieJar) Clone() *CookieJar {
+	clone := NewCookieJar()
+	clone.Merge(j)
+	return clone
+}
+
+// Merge copies the cookies of other into j, replacing the ones with the same name, domain and path
+func (j *CookieJar) Merge(other *CookieJar) {
+	other.mu.Lock()
+	cookies := make([]Cookie, 0, len(other.cookies))
+	for _, c := range other.cookies {
+		cookies = append(cookies, *c)
+	}
+	other.mu.Unlock()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range cookies {
+		j.cookies[cookieKey(&cookies[i])] = &cookies[i]
+	}
+}
+
+// All returns the cookies that have not expired, sorted by domain, path and name
+func (j *CookieJar) All() []*Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	cookies := []*Cookie{}
+	for _, c := range j.cookies {
+		if !c.expired(now) {
+			cookies = append(cookies, c)
+		}
+	}
+	sort.Slice(cookies, func(a, b int) bool { return cookieKey(cookies[a]) < cookieKey(cookies[b]) })
+	return cookies
+}
+
+// Cookies returns the cookies to send to host for path, RFC 6265 section 5.4
+// Secure cookies are only returned for https
+func (j *CookieJar) Cookies(host, path string, https bool) []*Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	host = strings.ToLower(host)
+	now := time.Now()
+	cookies := []*Cookie{}
+	for key, c := range j.cookies {
+		if c.expired(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		if c.Secure && !https {
+			continue
+		}
+		if c.HostOnly && host != c.Domain || !c.HostOnly && !domainMatch(host, c.Domain) {
+			continue
+		}
+		if !pathMatch(path, c.Path) {
+			continue
+		}
+		cookies = append(cookies, c)
+	}
+	// longer paths first, then earlier creation times
+	sort.Slice(cookies, func(a, b int) bool {
+		if len(cookies[a].Path) != len(cookies[b].Path) {
+			return len(cookies[a].Path) > len(cookies[b].Path)
+		}
+		return cookies[a].created.Before(cookies[b].created)
+	})
+	return cookies
+}
+
+// cookieHeader returns the Cookie field value for the request, "" if there are no cookies to send
+func (j *CookieJar) cookieHeader(r *request) string {
+	pairs := []string{}
+	for _, c := range j.Cookies(r.host, r.path, r.useHTTPS) {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// SetCookie stores the cookie of a Set-Cookie value received from host for path, RFC 6265 section 5.3
+// It returns the stored cookie, with an expiry in the past if the value deletes it
+func (j *CookieJar) SetCookie(host, path, value string) (*Cookie, error) {
+	c, err := parseSetCookie(strings.ToLower(host), path, value)
+	if err != nil {
+		return nil, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	key := cookieKey(c)
+	if old, ok := j.cookies[key]; ok {
+		c.created = old.created
+	}
+	if c.expired(time.Now()) {
+		delete(j.cookies, key)
+	} else {
+		j.cookies[key] = c
+	}
+	return c, nil
+}
+
+// setCookies stores the Set-Cookie fields of the response to r and prints them in verbose mode
+func (client *Client) setCookies(r *request, resp *Response) {
+	for _, v := range resp.Header.Values("Set-Cookie") {
+		c, err := client.Jar.SetCookie(r.host, r.path, v)
+		if !client.Verbose {
+			continue
+		}
+		if err != nil {
+			fmt.Println("Cookie rejected: " + err.Error())
+		} else if c.expired(time.Now()) {
+			fmt.Println("Cookie deleted: " + c.Name)
+		} else {
+			fmt.Println("Cookie stored: " + c.String())
+		}
+	}
+}
+
+func parseSetCookie(host, path, value string) (*Cookie, error) {
+	parts := strings.Split(value, ";")
+	eq := strings.IndexByte(parts[0], '=')
+	if eq < 0 {
+		return nil, errors.New("no name=value pair: " + value)
+	}
+	c := &Cookie{
+		Name:    strings.TrimSpace(parts[0][:eq]),
+		Value:   strings.TrimSpace(parts[0][eq+1:]),
+		created: time.Now(),
+	}
+	if c.Name == "" {
+		return nil, errors.New("empty cookie name: " + value)
+	}
+
+	var domain string
+	hasMaxAge := false
+	for _, attr := range parts[1:] {
+		name, val := attr, ""
+		if i := strings.IndexByte(attr, '='); i >= 0 {
+			name, val = attr[:i], attr[i+1:]
+		}
+		name, val = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(val)
+		switch name {
+		case "expires":
+			if hasMaxAge {
+				continue
+			}
+			if t, ok := parseCookieDate(val); ok {
+				c.Expires = t
+			}
+		case "max-age":
+			seconds, err := strconv.Atoi(val)
+			if err != nil {
+				continue
+			}
+			hasMaxAge = true
+			if seconds <= 0 {
+				c.Expires = time.Unix(1, 0)
+			} else {
+				c.Expires = time.Now().Add(time.Duration(seconds) * time.Second)
+			}
+		case "domain":
+			domain = strings.ToLower(strings.TrimPrefix(val, "."))
+		case "path":
+			if strings.HasPrefix(val, "/") {
+				c.Path = val
+			}
+		case "secure":
+			c.Secure = true
+		case "httponly":
+			c.HTTPOnly = true
+		}
+	}
+
+	if domain == "" {
+		c.Domain, c.HostOnly = host, true
+	} else {
+		if !domainMatch(host, domain) {
+			return nil, fmt.Errorf("%s: domain %s does not match host %s", c.Name, domain, host)
+		}
+		if !strings.Contains(domain, ".") && domain != host {
+			return nil, fmt.Errorf("%s: domain %s is a top level domain", c.Name, domain)
+		}
+		c.Domain = domain
+	}
+	if c.Path == "" {
+		c.Path = defaultPath(path)
+	}
+	return c, nil
+}
+
+// cookieDateLayouts are the date formats of Expires seen in practice
+var cookieDateLayouts = []string{
+	time.RFC1123,
+	"Mon, 02-Jan-2006 15:04:05 MST",
+	"Mon, 02 Jan 06 15:04:05 MST",
+	"Mon, 02-Jan-06 15:04:05 MST",
+	time.RFC850,
+	time.ANSIC,
+}
+
+func parseCookieDate(v string) (time.Time, bool) {
+	for _, layout := range cookieDateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// domainMatch reports whether host domain-matches domain, RFC 6265 section 5.1.3
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+// pathMatch reports whether the request path path-matches the cookie path, RFC 6265 section 5.1.4
+func pathMatch(path, cookiePath string) bool {
+	if path == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(path, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || path[len(cookiePath)] == '/'
+}
+
+// defaultPath is the directory of the request path, RFC 6265 section 5.1.4
+func defaultPath(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if !strings.HasPrefix(path, "/") || i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// httpOnlyPrefix marks the HttpOnly cookies of a Netscape cookie file, as curl writes them
+const httpOnlyPrefix = "#HttpOnly_"
+
+// LoadFile adds the cookies of a Netscape format cookie file, as written by curl -c, to the jar
+// Each line is domain, include subdomains, path, secure, expiry in unix seconds, name and value separated by tabs
+func (j *CookieJar) LoadFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("%s:%d: want 7 tab separated fields", name, n)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid expiry %s", name, n, fields[4])
+		}
+		c := &Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HTTPOnly: httpOnly,
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			created:  time.Now(),
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		j.cookies[cookieKey(c)] = c
+	}
+	return scanner.Err()
+}
+
+// SaveFile writes the cookies of the jar to a Netscape format cookie file, session cookies with expiry 0
+func (j *CookieJar) SaveFile(name string) error {
+	var sb strings.Builder
+	sb.WriteString("# Netscape HTTP Cookie File\n")
+	for _, c := range j.All() {
+		domain, subdomains := c.Domain, "FALSE"
+		if !c.HostOnly {
+			domain, subdomains = "."+c.Domain, "TRUE"
+		}
+		if c.HTTPOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+		secure := "FALSE"
+		if c.Secure {
+			secure = "TRUE"
+		}
+		fmt.Fprintf(&sb, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, subdomains, c.Path, secure, expires, c.Name, c.Value)
+	}
+	return ioutil.WriteFile(name, []byte(sb.String()), 0600)
+}
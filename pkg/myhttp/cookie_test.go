@@ -0,0 +1,127 @@
+package myhttp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDomainMatch(t *testing.T) {
+	tests := []struct {
+		host, domain string
+		want         bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "example.com", true},
+		{"a.b.example.com", "example.com", true},
+		{"badexample.com", "example.com", false},
+		{"example.com", "www.example.com", false},
+		{"com", "example.com", false},
+		{"192.168.0.1", "192.168.0.1", true},
+		{"1.2.3.4", "2.3.4", false},
+	}
+	for _, tt := range tests {
+		if got := domainMatch(tt.host, tt.domain); got != tt.want {
+			t.Errorf("domainMatch(%q, %q) = %v, want %v", tt.host, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestPathMatch(t *testing.T) {
+	tests := []struct {
+		path, cookiePath string
+		want             bool
+	}{
+		{"/", "/", true},
+		{"/docs", "/", true},
+		{"/docs", "/docs", true},
+		{"/docs/", "/docs", true},
+		{"/docs/web", "/docs", true},
+		{"/docs/web", "/docs/", true},
+		{"/docsweb", "/docs", false},
+		{"/doc", "/docs", false},
+		{"/", "/docs", false},
+		{"/Docs", "/docs", false},
+	}
+	for _, tt := range tests {
+		if got := pathMatch(tt.path, tt.cookiePath); got != tt.want {
+			t.Errorf("pathMatch(%q, %q) = %v, want %v", tt.path, tt.cookiePath, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/a", "/"},
+		{"/a/", "/a"},
+		{"/a/b", "/a"},
+		{"/a/b/c.html", "/a/b"},
+		{"a/b", "/"},
+	}
+	for _, tt := range tests {
+		if got := defaultPath(tt.path); got != tt.want {
+			t.Errorf("defaultPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	j := NewCookieJar()
+	set := []struct {
+		host, path, value string
+		ok                bool
+	}{
+		{"www.example.com", "/docs/index.html", "host=1", true},
+		{"www.example.com", "/", "domain=2; Domain=.example.com; Path=/", true},
+		{"www.example.com", "/", "secure=3; Secure; Path=/", true},
+		{"www.example.com", "/", "deep=4; Path=/docs/web", true},
+		{"www.example.com", "/", "other=5; Domain=other.com", false},
+		{"www.example.com", "/", "tld=6; Domain=com", false},
+		{"www.example.com", "/", "noname", false},
+		{"www.example.com", "/", "=7", false},
+	}
+	for _, s := range set {
+		if _, err := j.SetCookie(s.host, s.path, s.value); (err == nil) != s.ok {
+			t.Errorf("SetCookie(%q) error %v, want ok %v", s.value, err, s.ok)
+		}
+	}
+	tests := []struct {
+		host, path string
+		https      bool
+		want       []string
+	}{
+		{"www.example.com", "/docs/web/page", true, []string{"deep", "host", "domain", "secure"}},
+		{"www.example.com", "/docs", false, []string{"host", "domain"}},
+		{"WWW.Example.com", "/", false, []string{"domain"}},
+		{"api.example.com", "/docs", true, []string{"domain"}},
+		{"example.org", "/", true, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range j.Cookies(tt.host, tt.path, tt.https) {
+			got = append(got, c.Name)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Cookies(%s, %s, %v) = %v, want %v", tt.host, tt.path, tt.https, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Cookies(%s, %s, %v) = %v, want %v", tt.host, tt.path, tt.https, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// a Max-Age of 0 deletes the cookie
+	c, err := j.SetCookie("www.example.com", "/", "domain=; Domain=example.com; Max-Age=0")
+	if err != nil || !c.expired(time.Now()) {
+		t.Fatalf("SetCookie with Max-Age=0 = %v, %v, want an expired cookie", c, err)
+	}
+	if got := j.Cookies("www.example.com", "/", false); len(got) != 0 {
+		t.Errorf("Cookies after the delete = %v, want none", got)
+	}
+}
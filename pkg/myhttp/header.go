@@ -0,0 +1,76 @@
+package myhttp
+
+import "strings"
+
+// Header is the list of HTTP header fields in the order they are sent or received
+// Names are compared case-insensitively
+type Header []HeaderField
+
+// HeaderField is one name: value line of a Header
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// Get returns the value of the first field with the name, or "" if there is none
+func (h Header) Get(name string) string {
+	for _, f := range h {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Values returns the values of all the fields with the name
+func (h Header) Values(name string) []string {
+	var values []string
+	for _, f := range h {
+		if strings.EqualFold(f.Name, name) {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Add appends a field
+func (h *Header) Add(name, value string) {
+	*h = append(*h, HeaderField{Name: name, Value: value})
+}
+
+// Set replaces the value of the first field with the name and removes the others,
+// or appends the field if there is none
+func (h *Header) Set(name, value string) {
+	for i, f := range *h {
+		if strings.EqualFold(f.Name, name) {
+			(*h)[i].Value = value
+			h.del(name, i+1)
+			return
+		}
+	}
+	h.Add(name, value)
+}
+
+// Del removes all the fields with the name
+func (h *Header) Del(name string) {
+	h.del(name, 0)
+}
+
+func (h *Header) del(name string, from int) {
+	kept := (*h)[:from]
+	for _, f := range (*h)[from:] {
+		if !strings.EqualFold(f.Name, name) {
+			kept = append(kept, f)
+		}
+	}
+	*h = kept
+}
+
+// String returns the fields as they are sent, each followed by CRLF
+func (h Header) String() string {
+	var sb strings.Builder
+	for _, f := range h {
+		sb.WriteString(f.Name + ": " + f.Value + "\r\n")
+	}
+	return sb.String()
+}
@@ -5,11 +5,14 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -19,17 +22,129 @@ type request struct {
 	useHTTPS bool
 	Header   string
 	addr     string
+	host     string
+	port     string
+	path     string
+	proxy    *url.URL
+	// target is the path and query of the request line, before the absolute-form of a proxy
+	target string
+	// expectContinue is set when the header asks for 100 Continue before the body
+	expectContinue bool
+	// digest is set when the request answers a Digest challenge
+	digest bool
+	// header are the fields of Header
+	header Header
+	// bodyLength is the Content-Length of the body
+	bodyLength int64
+}
+
+// Request is an HTTP request to send with Client.Do
+type Request struct {
+	// Method is GET if empty
+	Method string
+	URL    string
+	// Header is sent after the default Host, User-Agent and Accept fields, which it can replace
+	Header Header
+	// Body is sent after the header with its Content-Length
+	Body []byte
+	// BodyFile, if set, is the file sent as the body instead of Body, opened for each request
+	// and streamed from disk so large uploads are not held in memory
+	BodyFile string
+	// Ranges, if set, are asked for with a Range header and the 206 responses are checked against them
+	Ranges []ByteRange
+	// SlashPath appends "/" to a path with neither a trailing "/" nor a dot, as to a directory,
+	// otherwise the path is sent exactly as in URL
+	SlashPath bool
 }
 
 // Response is used for workers to store one HTTP request results
 type Response struct {
-	Status       string
+	// Request is the request the response answers
+	Request *Request
+	// RequestHeader are the header fields sent, with the ones set by the client
+	RequestHeader Header
+	// RequestPath is the path and query of the request line as sent, e.g. /search?q=a+b
+	RequestPath string
+	// Proto is the version of the final response, e.g. HTTP/1.1
+	Proto  string
+	Status string
+	Header Header
+	// Interim are the 1xx responses received before the final one
+	Interim []InterimResponse
+	// ContinueTime is the time in ms waited after the header for 100 Continue when Client.ExpectContinue is set,
+	// ContinueStatus the status code that ended the wait, 0 if the wait timed out and the body was sent anyway
+	ContinueTime   int64
+	ContinueStatus int
+	// Challenged is set if the request was sent again to answer the Digest challenge of a 401 response,
+	// the times are the ones of the second request
+	Challenged bool
+	// Warnings are the protocol violations found if Client.Strict is set
+	Warnings []Warning
+	// Parts are the ranges of a 206 response to a request with Ranges
+	// and RangeError is why the response does not match them, "" if it does
+	// RangeMismatch is the kind of the mismatch, one of the Mismatch constants
+	Parts         []ContentRange
+	RangeError    string
+	RangeMismatch string
+	// ResponseBody is only kept if Client.Body is nil
 	ResponseBody string
 	StatusCode   int
+	// ResponseSize is the size of the whole response in bytes, BodySize the size of the decoded body
+	// Truncated is set if the body was longer than Client.MaxBody
 	ResponseSize int64
+	BodySize     int64
+	Truncated    bool
 	TTFB         int64
-	tStart       time.Time
-	tFirstByte   time.Time
+	// Position is the 1-based index of the response in a pipelined batch,
+	// it is 0 for requests sent on their own
+	Position int
+	// Proxy is the proxy host the request went through
+	// and ProxyTime the time in ms to connect to it and open the tunnel
+	Proxy     string
+	ProxyTime int64
+	// RemoteAddr is the ip:port the connection was made to
+	// and Network the network of Client when the request was sent
+	RemoteAddr string
+	Network    string
+	// LocalAddr is the source ip:port of the connection
+	LocalAddr string
+	// TCPInfo is read from the socket after the response if Client.TCPInfo is set
+	TCPInfo *TCPInfo
+	// Timings are the durations of the phases of the request
+	Timings Timings
+	// TLS is the state of the TLS connection of https requests
+	TLS        *tls.ConnectionState
+	tStart     time.Time
+	tSent      time.Time
+	tFirstByte time.Time
+}
+
+// Timings are the durations of the phases of a request, the phases that did not happen are 0
+// DNS is only measured for hosts connected to directly, the time through a proxy is in Connect
+type Timings struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// Send is the time to write the request, with the wait for 100 Continue
+	Send time.Duration
+	// Wait is the time from the end of the request to the first byte of the final response
+	Wait time.Duration
+	// Receive is the time from the first byte to the end of the response
+	Receive time.Duration
+}
+
+// StartTime returns the time the request was started
+func (r *Response) StartTime() time.Time {
+	return r.tStart
+}
+
+// InterimResponse is a 1xx response, e.g. 100 Continue or 103 Early Hints
+type InterimResponse struct {
+	Status     string
+	StatusCode int
+	Header     Header
+	// Time is the time in ms from the start of the request to the interim response
+	Time int64
 }
 
 // Client keep the connection and request website
@@ -37,35 +152,232 @@ type Client struct {
 	HTTP10  bool
 	Verbose bool
 	Conn    net.Conn
+	// Proxy is the URL of an http, https, socks5 or socks5h proxy
+	// If empty, the proxy is taken from the environment variables
+	Proxy string
+	// Resolve and ConnectTo override the address to connect to, see ParseResolve and ParseConnectTo
+	// DNSServer is the ip[:port] of the name server used to resolve hosts instead of the system one
+	// They do not apply when requesting through a proxy
+	Resolve   map[string]string
+	ConnectTo map[string]string
+	DNSServer string
+	// IP, if set, is connected to instead of the resolved host
+	IP string
+	// Network is "tcp4" or "tcp6" to only use IPv4 or IPv6, and "tcp" or empty for both
+	Network string
+	// LocalIP, if set, is the source address the connections are bound to
+	LocalIP string
+	// UnixSocket, if set, is the path of the Unix domain socket to send the requests over
+	// The url still gives the Host header and path, and TLS is used only for https:// urls
+	UnixSocket string
+	// TCPInfo reads the kernel TCP metrics of the connection after each response, Linux only
+	TCPInfo bool
+	// SplitDNS resolves the host before dialing so Response.Timings has the DNS time apart from Connect
+	// The addresses are then dialed in turn, without the IPv4 fallback of net.Dialer
+	SplitDNS bool
+	// Nagle clears TCP_NODELAY, which Go sets by default
+	Nagle bool
+	// ReadBuffer and WriteBuffer set SO_RCVBUF and SO_SNDBUF in bytes if positive
+	ReadBuffer  int
+	WriteBuffer int
+	// KeepAlive is the TCP keepalive period, 0 for the Go default and negative to disable it
+	KeepAlive time.Duration
+	// Linger sets SO_LINGER in seconds if positive, ResetOnClose sets it to 0 so closing sends a RST
+	Linger       int
+	ResetOnClose bool
+	// Body, if set, receives the response bodies instead of Response.ResponseBody
+	// Use ioutil.Discard to only count the body size, or a BodyOpener to choose the writer by response
+	Body io.Writer
+	// MaxBody, if positive, is the max number of body bytes kept or written to Body
+	// The rest of the body is still read and counted in the response size
+	MaxBody int64
+	// Strict checks the responses against RFC 9110 and RFC 9112 and records the violations
+	// in Response.Warnings, the responses are read the same way as without it
+	Strict bool
+	// Username and Password are sent with Basic authentication, or with Digest once a 401 response
+	// challenges it, BearerToken is sent as a Bearer token if there is no Username
+	Username    string
+	Password    string
+	BearerToken string
+	// Signer, if set, signs each request after all its header fields are set
+	Signer Signer
+	// digest is the Digest challenge answered by the requests
+	digest *digestChallenge
+	// Jar, if set, stores the cookies of the responses and sends them with the requests
+	// Client copies share the jar, give each a CookieJar.Clone to keep the sessions apart
+	Jar *CookieJar
+	// ExpectContinue sends requests with a body with Expect: 100-continue and waits up to
+	// ContinueTimeout for 100 Continue before sending the body, a final response is read without sending it
+	// It does not apply to pipelined and HTTP/1.0 requests
+	ExpectContinue  bool
+	ContinueTimeout time.Duration
+	// rawConn is the TCP connection under Conn, under the TLS of the request or of an https proxy
+	rawConn net.Conn
+}
+
+// BodyOpener is a Client.Body that returns the writer for each response body
+// once the header of the final response is read
+type BodyOpener interface {
+	io.Writer
+	OpenBody(r *Response) (io.Writer, error)
 }
 
 type responseHandler struct {
 	chunked         bool  // Transfer-Encoding: chunked
 	shouldCloseConn bool  // Connection: close or keep-alive
-	contentLength   int64 // Content-Length: int
+	contentLength   int64 // Content-Length: int, -1 if unknown
+	noBody          bool  // response to HEAD, 1xx, 204 or 304
 	verbose         bool
+	version         string    // HTTP version of the status line
+	strict          bool      // collect protocol violations in resp.Warnings
+	resp            *Response // the response being read
 	br              *bufio.Reader
 }
 
-func connect(ctx context.Context, r *request) (conn net.Conn, err error) {
-	ch := make(chan bool)
-	go func() {
-		if r.useHTTPS {
-			d := &tls.Dialer{}
-			conn, err = d.DialContext(ctx, "tcp", r.addr)
-		} else {
-			d := &net.Dialer{}
-			conn, err = d.DialContext(ctx, "tcp", r.addr)
+var noDeadline = time.Time{}
+
+func (client *Client) connect(ctx context.Context, r *request, resp *Response) (conn net.Conn, err error) {
+	d := &net.Dialer{Resolver: client.resolver(), KeepAlive: client.KeepAlive}
+	if client.hasSocketOptions() {
+		d.Control = client.control
+	}
+	if client.LocalIP != "" {
+		ip := net.ParseIP(client.LocalIP)
+		if ip == nil {
+			return nil, errors.New("Invalid local IP: " + client.LocalIP)
 		}
-		ch <- true
-	}()
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	resp.Network = client.network()
+	// raw is the TCP connection, under the TLS of an https proxy
+	var raw net.Conn
+	if client.UnixSocket != "" {
+		resp.Network = "unix"
+		conn, err = d.DialContext(ctx, "unix", client.UnixSocket)
+	} else if r.proxy != nil {
+		tProxy := time.Now()
+		conn, raw, err = dialProxy(ctx, d, resp.Network, r.proxy, r)
+		resp.Proxy = r.proxy.Host
+		resp.ProxyTime = time.Since(tProxy).Milliseconds()
+	} else {
+		conn, err = client.dial(ctx, d, resp.Network, client.dialAddr(r), resp)
+	}
+	if resp.Timings.Connect == 0 {
+		resp.Timings.Connect = time.Since(resp.tStart) - resp.Timings.DNS
+	}
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		raw = conn
+	}
+	if tcpConn, ok := raw.(*net.TCPConn); ok && client.Nagle {
+		if err = tcpConn.SetNoDelay(false); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	resp.RemoteAddr = conn.RemoteAddr().String()
+	resp.LocalAddr = conn.LocalAddr().String()
+	client.rawConn = raw
+	if r.useHTTPS {
+		tTLS := time.Now()
+		conn, err = handshakeTLS(ctx, conn, r.host)
+		resp.Timings.TLS = time.Since(tTLS)
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			state := tlsConn.ConnectionState()
+			resp.TLS = &state
+		}
+		return conn, err
+	}
+	return conn, nil
+}
 
-	select {
-	case <-ch:
+// dial connects to addr, resolving its host apart from the connection when SplitDNS is set so both are timed
+// The addresses are then tried in turn, each with its share of the time left like net.Dialer does,
+// otherwise net.Dialer dials them with its IPv4 fallback
+func (client *Client) dial(ctx context.Context, d *net.Dialer, network, addr string, resp *Response) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil || !client.SplitDNS {
+		return d.DialContext(ctx, network, addr)
+	}
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	tDNS := time.Now()
+	ips, err := resolver.LookupIP(ctx, ipNetwork(network), host)
+	resp.Timings.DNS = time.Since(tDNS)
+	if err != nil {
+		return nil, err
+	}
+	tConnect := time.Now()
+	defer func() { resp.Timings.Connect = time.Since(tConnect) }()
+	for i, ip := range ips {
+		dialCtx, cancel := ctx, func() {}
+		if deadline, ok := ctx.Deadline(); ok {
+			dialCtx, cancel = context.WithDeadline(ctx, partialDeadline(time.Now(), deadline, len(ips)-i))
+		}
+		var conn net.Conn
+		conn, err = d.DialContext(dialCtx, network, net.JoinHostPort(ip.String(), port))
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// partialDeadline returns the deadline to dial one of the addresses left before deadline,
+// an even share of the time left but at least 2s, as net.Dialer gives each address
+func partialDeadline(now, deadline time.Time, addrsRemaining int) time.Time {
+	timeout := deadline.Sub(now) / time.Duration(addrsRemaining)
+	if min := 2 * time.Second; timeout < min {
+		timeout = min
+	}
+	if now.Add(timeout).Before(deadline) {
+		return now.Add(timeout)
+	}
+	return deadline
+}
+
+// readTCPInfo sets resp.TCPInfo if Client.TCPInfo is set
+// Failing to read it is not a request error, so it is only printed in verbose mode
+func (client *Client) readTCPInfo(resp *Response) {
+	if !client.TCPInfo || client.rawConn == nil {
+		return
+	}
+	info, err := readTCPInfo(client.rawConn)
+	if err != nil {
+		if client.Verbose {
+			fmt.Println("TCP_INFO error: " + err.Error())
+		}
 		return
-	case <-ctx.Done():
-		return nil, ctx.Err()
 	}
+	resp.TCPInfo = info
+	if client.Verbose {
+		fmt.Printf("TCP_INFO rtt=%dus rttvar=%dus retransmits=%d cwnd=%d\n", info.RTT, info.RTTVar, info.Retransmits, info.Cwnd)
+	}
+}
+
+func (client *Client) network() string {
+	if client.Network == "" {
+		return "tcp"
+	}
+	return client.Network
+}
+
+func handshakeTLS(ctx context.Context, conn net.Conn, serverName string) (net.Conn, error) {
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName})
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(noDeadline)
+	return tlsConn, nil
 }
 
 type connWithCounter struct {
@@ -81,11 +393,19 @@ func (cc *connWithCounter) Read(p []byte) (int, error) {
 
 // GET request the url with HTTP GET
 func (client *Client) GET(url string) (*Response, error) {
+	return client.Do(&Request{Method: "GET", URL: url, SlashPath: true})
+}
+
+// Do sends the request on a new connection and reads the response
+func (client *Client) Do(req *Request) (*Response, error) {
+	return client.do(req, false)
+}
+
+// do sends the request, and sends it once more if its 401 response has a Digest challenge
+// and it is not already the answer to one, retried, in which case the 401 is returned
+func (client *Client) do(req *Request, retried bool) (*Response, error) {
 	var err error
-	request, err := client.newRequest(url)
-	if client.Verbose {
-		fmt.Print(request.Header)
-	}
+	request, err := client.newRequest(req, false)
 	if err != nil {
 		return nil, err
 	}
@@ -93,30 +413,136 @@ func (client *Client) GET(url string) (*Response, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	resp := &Response{tStart: time.Now()}
-	client.Conn, err = connect(ctx, request)
+	resp := &Response{Request: req, RequestHeader: request.header, RequestPath: request.target, tStart: time.Now()}
+	client.Conn, err = client.connect(ctx, request, resp)
 
 	if err != nil {
 		return nil, err
 	}
+	if client.Verbose {
+		fmt.Println("Connected to " + request.addr + " (" + resp.RemoteAddr + ")")
+		fmt.Print(request.Header)
+	}
+	tSend := time.Now()
 	_, err = client.Conn.Write([]byte(request.Header))
 	if err != nil {
 		return nil, err
 	}
 
-	err = client.ReadResponse(resp)
+	cc := &connWithCounter{reader: client.Conn}
+	br := bufio.NewReader(cc)
+	sendBody := request.bodyLength > 0
+	if sendBody && request.expectContinue {
+		if sendBody, err = client.waitContinue(br, resp); err != nil {
+			return nil, err
+		}
+	}
+	if sendBody {
+		if err = req.writeBody(client.Conn); err != nil {
+			return nil, err
+		}
+	}
+	resp.tSent = time.Now()
+	resp.Timings.Send = resp.tSent.Sub(tSend)
+
+	err = client.readResponse(br, cc, resp)
 	if err != nil {
 		return nil, err
 	}
+	if client.Jar != nil {
+		client.setCookies(request, resp)
+	}
 	resp.TTFB = resp.tFirstByte.Sub(resp.tStart).Milliseconds()
+	client.readTCPInfo(resp)
 
+	if resp.StatusCode == 401 && !retried && client.challenged(request, resp) {
+		client.Conn.Close()
+		if resp, err = client.do(req, true); err != nil {
+			return nil, err
+		}
+		resp.Challenged = true
+	}
 	return resp, err
 }
 
-func (client *Client) newRequest(reqURL string) (*request, error) {
+// DesyncError is returned by Pipeline when the response at Position could
+// not be framed, so it and all the responses after it are lost
+type DesyncError struct {
+	Position int
+	Err      error
+}
+
+func (e *DesyncError) Error() string {
+	return fmt.Sprintf("framing desync at response %d: %s", e.Position, e.Err.Error())
+}
+
+// Pipeline writes the request n times back to back on one
+// connection, and then reads the n responses in order.
+// The requests are sent without Expect: 100-continue, as their bodies are written without waiting.
+// On a *DesyncError the responses read before Position are returned.
+func (client *Client) Pipeline(req *Request, n int) ([]*Response, error) {
+	request, err := client.newRequest(req, true)
+	if err != nil {
+		return nil, err
+	}
+	if client.Verbose {
+		fmt.Print(request.Header)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	first := &Response{Request: req, RequestHeader: request.header, RequestPath: request.target, tStart: time.Now(), Position: 1}
+	client.Conn, err = client.connect(ctx, request, first)
+	if err != nil {
+		return nil, err
+	}
+	tSend := time.Now()
+	bw := bufio.NewWriter(client.Conn)
+	for i := 0; i < n && err == nil; i++ {
+		if _, err = bw.WriteString(request.Header); err == nil {
+			err = req.writeBody(bw)
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	tSent := time.Now()
+
+	cc := &connWithCounter{reader: client.Conn}
+	br := bufio.NewReader(cc)
+	responses := make([]*Response, 0, n)
+	for i := 1; i <= n; i++ {
+		resp := &Response{Request: req, RequestHeader: request.header, RequestPath: request.target, tStart: first.tStart, tSent: tSent, Position: i, Proxy: first.Proxy, ProxyTime: first.ProxyTime,
+			RemoteAddr: first.RemoteAddr, Network: first.Network, LocalAddr: first.LocalAddr, TLS: first.TLS}
+		resp.Timings = first.Timings
+		resp.Timings.Send = tSent.Sub(tSend)
+		if err = client.readResponse(br, cc, resp); err != nil {
+			return responses, &DesyncError{Position: i, Err: err}
+		}
+		if client.Jar != nil {
+			client.setCookies(request, resp)
+		}
+		resp.TTFB = resp.tFirstByte.Sub(resp.tStart).Milliseconds()
+		client.readTCPInfo(resp)
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+// newRequest builds the request line and header of req, pipelined requests are not sent with Expect
+func (client *Client) newRequest(req *Request, pipelined bool) (*request, error) {
+	reqURL := req.URL
 	request := &request{useHTTPS: true}
 	if strings.HasPrefix(reqURL, "http://") {
 		request.useHTTPS = false
+	} else if client.UnixSocket != "" && !strings.HasPrefix(reqURL, "https://") {
+		// plain HTTP over Unix sockets unless https:// is asked for
+		request.useHTTPS = false
+		reqURL = "http://" + reqURL
 	} else if !strings.HasPrefix(reqURL, "https://") {
 		reqURL = "https://" + reqURL
 	}
@@ -135,100 +561,375 @@ func (client *Client) newRequest(reqURL string) (*request, error) {
 		}
 	}
 
-	request.addr = u.Hostname() + ":" + port
+	request.host = u.Hostname()
+	request.port = port
+	request.addr = net.JoinHostPort(request.host, port)
+	if client.UnixSocket == "" {
+		request.proxy, err = client.proxyURL(request)
+		if err != nil {
+			return nil, err
+		}
+	}
 	httpVersion := "1.1"
 	if client.HTTP10 {
 		httpVersion = "1.0"
 	}
-	path := u.Path
-	if !strings.HasSuffix(path, "/") && !strings.ContainsAny(path, ".") {
+	// the path is sent as escaped in the url, so escaped characters like %2F are kept
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	} else if req.SlashPath && !strings.HasSuffix(path, "/") && !strings.ContainsAny(path, ".") {
 		path = path + "/"
 	}
+	// the cookies are matched against the path of the request line, RFC 6265 section 5.1.4
+	request.path = path
+	target := path
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	request.target = target
+	proxyAuth := ""
+	if request.proxy != nil && !request.useHTTPS && strings.HasPrefix(request.proxy.Scheme, "http") {
+		// absolute-form, RFC 7230 section 5.3.2
+		target = "http://" + request.addr + target
+		proxyAuth = proxyAuthorization(request.proxy)
+	}
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
 	agentName := `Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.36`
+	header := Header{
+		{"HOST", u.Hostname()},
+		{"User-Agent", agentName},
+		{"Accept", "*/*"},
+	}
+	if request.bodyLength, err = req.length(); err != nil {
+		return nil, err
+	}
+	if request.bodyLength > 0 {
+		header.Add("Content-Length", strconv.FormatInt(request.bodyLength, 10))
+		if client.ExpectContinue && !client.HTTP10 && !pipelined {
+			header.Add("Expect", "100-continue")
+			request.expectContinue = true
+		}
+	}
+	if len(req.Ranges) > 0 {
+		header.Add("Range", rangeHeader(req.Ranges))
+	}
+	if client.Jar != nil {
+		if cookie := client.Jar.cookieHeader(request); cookie != "" {
+			header.Add("Cookie", cookie)
+		}
+	}
+	auth, err := client.authorization(request, method, target, req)
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" {
+		header.Add("Authorization", auth)
+	}
+	for _, f := range req.Header {
+		header.Set(f.Name, f.Value)
+	}
+	if client.Signer != nil {
+		scheme := "https"
+		if !request.useHTTPS {
+			scheme = "http"
+		}
+		signURL := &url.URL{Scheme: scheme, Host: request.addr, RawPath: path, RawQuery: u.RawQuery}
+		signURL.Path, _ = url.PathUnescape(path)
+		signed := &SignRequest{
+			Method:   method,
+			URL:      signURL,
+			Header:   &header,
+			Body:     req.Body,
+			BodyFile: req.BodyFile,
+		}
+		if err = client.Signer.Sign(signed); err != nil {
+			return nil, err
+		}
+	}
+	request.header = header
 	request.Header = fmt.Sprint(
-		"GET "+path+" HTTP/"+httpVersion+"\r\n",
-		"HOST: "+u.Hostname()+"\r\n",
-		"User-Agent: "+agentName+"\r\n",
-		"Accept: */*\r\n",
+		method+" "+target+" HTTP/"+httpVersion+"\r\n",
+		header.String(),
+		proxyAuth,
 		"\r\n",
 	)
 	return request, nil
 }
 
-func readLine(br *bufio.Reader) ([]byte, error) {
-	var line []byte
-	for {
-		l, more, err := br.ReadLine()
+// length returns the length of the body, the size of BodyFile if set
+func (req *Request) length() (int64, error) {
+	if req.BodyFile == "" {
+		return int64(len(req.Body)), nil
+	}
+	info, err := os.Stat(req.BodyFile)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// writeBody writes the body to w, streaming BodyFile if set
+func (req *Request) writeBody(w io.Writer) error {
+	if req.BodyFile == "" {
+		_, err := w.Write(req.Body)
+		return err
+	}
+	file, err := os.Open(req.BodyFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// bodyHash returns the hex digest of the body, reading BodyFile without holding it in memory
+func bodyHash(newHash func() hash.Hash, body []byte, bodyFile string) (string, error) {
+	sum := newHash()
+	if bodyFile == "" {
+		sum.Write(body)
+	} else {
+		file, err := os.Open(bodyFile)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
-		if line == nil && !more {
-			return l, nil
+		defer file.Close()
+		if _, err = io.Copy(sum, file); err != nil {
+			return "", err
 		}
-		line = append(line, l...)
-		if !more {
-			break
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// readLine reads a line without its line ending, crlf reports whether it ended with CRLF or a bare LF
+func readLine(br *bufio.Reader) (line []byte, crlf bool, err error) {
+	for {
+		l, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			line = append(line, l...)
+			continue
+		}
+		if err != nil {
+			return nil, false, err
 		}
+		if line == nil {
+			line = l
+		} else {
+			line = append(line, l...)
+		}
+		break
 	}
-	return line, nil
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1], true, nil
+	}
+	return line, false, nil
 }
 
-func (handler *responseHandler) readResponseBody(r *Response) ([]byte, error) {
+// readResponseBody copies the body to w and returns its length
+// Like reading until io.EOF, a read error ends the body, only write errors are returned
+func (handler *responseHandler) readResponseBody(w io.Writer) (int64, error) {
+	// message body length, RFC 9112 section 6.3
 	var reader io.Reader
-	if handler.shouldCloseConn { // http 1.0
-		reader = handler.br
+	if handler.noBody || handler.contentLength == 0 { // no content
+		return 0, nil
+	} else if handler.chunked {
+		cr := &chunkedReader{r: handler.br}
+		if handler.strict {
+			cr.warn = handler.warn
+		}
+		reader = cr
 	} else if handler.contentLength > 0 {
 		reader = io.LimitReader(handler.br, handler.contentLength)
-	} else if handler.chunked {
-		reader = NewChunkedReader(handler.br)
-	} else { // no content
-		return []byte{}, nil
+	} else { // read until the server closes the connection, e.g. http 1.0
+		reader = handler.br
 	}
 
-	var body []byte
+	var total int64
+	buffer := make([]byte, 32*1024)
 	for { // read until io.EOF
-		var buffer = make([]byte, 4096)
 		n, err := reader.Read(buffer)
-		if n > 0 && (err == nil || err == io.EOF) {
-			body = append(body, buffer[:n]...)
+		if n > 0 {
+			if _, werr := w.Write(buffer[:n]); werr != nil {
+				return total, werr
+			}
+			total += int64(n)
 		}
 		if err != nil {
-			if err == io.EOF && n == 0 {
-				err = nil
-			}
-			return body, nil
+			return total, nil
+		}
+	}
+}
+
+// cappedWriter writes the first n bytes to w and discards the rest
+type cappedWriter struct {
+	w         io.Writer
+	n         int64
+	truncated bool
+}
+
+func (cw *cappedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > cw.n {
+		cw.truncated = true
+		if _, err := cw.w.Write(p[:cw.n]); err != nil {
+			return 0, err
 		}
+		cw.n = 0
+		return len(p), nil
 	}
+	n, err := cw.w.Write(p)
+	cw.n -= int64(n)
+	return n, err
 }
 
 // ReadResponse read client.conn to Response
 func (client *Client) ReadResponse(r *Response) (err error) {
 	cc := &connWithCounter{reader: client.Conn}
-	handler := &responseHandler{br: bufio.NewReader(cc), verbose: client.Verbose}
-	if err = handler.readStatusLine(r); err != nil {
-		return err
-	}
+	return client.readResponse(bufio.NewReader(cc), cc, r)
+}
 
-	if err = handler.readHeader(r); err != nil {
-		return err
+// readResponse reads one response from br, which may hold bytes of the
+// following responses when requests are pipelined. The response size is
+// the number of bytes consumed from br, not read from the connection.
+func (client *Client) readResponse(br *bufio.Reader, cc *connWithCounter, r *Response) (err error) {
+	start := cc.totalBytes - int64(br.Buffered())
+	var handler *responseHandler
+	for {
+		handler = &responseHandler{br: br, verbose: client.Verbose, contentLength: -1, strict: client.Strict, resp: r}
+		if err = handler.readStatusLine(r); err != nil {
+			return err
+		}
+		if err = handler.readHeader(r); err != nil {
+			return err
+		}
+		// interim responses are skipped, except 101 Switching Protocols which is final
+		if r.StatusCode/100 != 1 || r.StatusCode == 101 {
+			break
+		}
+		client.addInterim(r)
+	}
+	if r.Request != nil && r.Request.Method == "HEAD" {
+		handler.noBody = true
+	}
+	if r.StatusCode/100 == 1 || r.StatusCode == 204 || r.StatusCode == 304 {
+		handler.noBody = true
 	}
 
-	var responseBody []byte
-	responseBody, err = handler.readResponseBody(r)
+	var body strings.Builder
+	w := client.Body
+	if opener, ok := w.(BodyOpener); ok {
+		if w, err = opener.OpenBody(r); err != nil {
+			return err
+		}
+	}
+	if w == nil {
+		w = &body
+	}
+	var cw *cappedWriter
+	if client.MaxBody > 0 {
+		cw = &cappedWriter{w: w, n: client.MaxBody}
+		w = cw
+	}
+	var rc *rangeChecker
+	if r.Request != nil && len(r.Request.Ranges) > 0 && r.StatusCode == 206 {
+		rc = newRangeChecker(r.Request.Ranges, r.Header)
+		w = io.MultiWriter(rc, w)
+	}
+	r.BodySize, err = handler.readResponseBody(w)
+	if rc != nil {
+		var m *RangeMismatch
+		if r.Parts, m = rc.finish(); m != nil {
+			r.RangeMismatch, r.RangeError = m.Kind, m.Error()
+		}
+	}
 	if err != nil {
 		return err
 	}
+	r.Truncated = cw != nil && cw.truncated
 
-	r.ResponseBody = string(responseBody)
-	r.ResponseSize = cc.totalBytes
+	r.ResponseBody = body.String()
+	r.ResponseSize = cc.totalBytes - int64(br.Buffered()) - start
+	if !r.tSent.IsZero() {
+		r.Timings.Wait = r.tFirstByte.Sub(r.tSent)
+	}
+	r.Timings.Receive = time.Since(r.tFirstByte)
 
 	return nil
 
 }
 
+// addInterim moves the 1xx response read into r to r.Interim,
+// the time to first byte is then measured to the next response
+func (client *Client) addInterim(r *Response) {
+	interim := InterimResponse{
+		Status:     r.Status,
+		StatusCode: r.StatusCode,
+		Header:     r.Header,
+		Time:       time.Since(r.tStart).Milliseconds(),
+	}
+	r.Interim = append(r.Interim, interim)
+	if client.Verbose && r.StatusCode == 103 {
+		fmt.Printf("Early Hints after %d ms:\n", interim.Time)
+		for _, link := range interim.Header.Values("Link") {
+			fmt.Println("  " + link)
+		}
+	}
+	r.Header = nil
+	r.tFirstByte = time.Time{}
+}
+
+// waitContinue waits up to ContinueTimeout for the answer to Expect: 100-continue,
+// RFC 9110 section 10.1.1, and reports whether the body should be sent.
+// A 100 Continue is read into r.Interim, a final response is left in br for readResponse.
+func (client *Client) waitContinue(br *bufio.Reader, r *Response) (bool, error) {
+	tSent := time.Now()
+	client.Conn.SetReadDeadline(tSent.Add(client.ContinueTimeout))
+	// the status code ends at the 12th byte of the status line
+	head, err := br.Peek(len("HTTP/1.1 100"))
+	client.Conn.SetReadDeadline(noDeadline)
+	r.ContinueTime = time.Since(tSent).Milliseconds()
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			if client.Verbose {
+				fmt.Printf("No 100 Continue after %d ms, sending the body\n", r.ContinueTime)
+			}
+			return true, nil
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return false, err
+	}
+	r.ContinueStatus, _ = strconv.Atoi(string(head[9:12]))
+	if r.ContinueStatus != 100 {
+		if client.Verbose {
+			fmt.Printf("Final response after %d ms, the body is not sent\n", r.ContinueTime)
+		}
+		return false, nil
+	}
+	handler := &responseHandler{br: br, verbose: client.Verbose, contentLength: -1, strict: client.Strict, resp: r}
+	if err = handler.readStatusLine(r); err != nil {
+		return false, err
+	}
+	if err = handler.readHeader(r); err != nil {
+		return false, err
+	}
+	if client.Verbose {
+		fmt.Printf("100 Continue after %d ms, sending the body\n", r.ContinueTime)
+	}
+	client.addInterim(r)
+	return true, nil
+}
+
 func (handler *responseHandler) readStatusLine(r *Response) error {
-	line, err := readLine(handler.br)
-	r.tFirstByte = time.Now()
+	line, crlf, err := readLine(handler.br)
+	if r.tFirstByte.IsZero() {
+		r.tFirstByte = time.Now()
+	}
 	if err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
@@ -240,11 +941,16 @@ func (handler *responseHandler) readStatusLine(r *Response) error {
 	if handler.verbose {
 		fmt.Println(stringLine)
 	}
+	handler.checkLineEnding(line, crlf)
+	handler.checkStatusLine(stringLine)
 	if i = strings.IndexByte(stringLine, ' '); i == -1 {
 		return errors.New("Invalid HTTP response: " + stringLine)
 	}
+	handler.version = stringLine[:i]
+	r.Proto = handler.version
 	r.Status = strings.TrimSpace(stringLine[i+1:])
-	status := ""
+	// the reason phrase is optional
+	status := r.Status
 	if i = strings.IndexByte(r.Status, ' '); i != -1 {
 		status = r.Status[:i]
 	}
@@ -253,20 +959,46 @@ func (handler *responseHandler) readStatusLine(r *Response) error {
 	}
 	r.StatusCode, err = strconv.Atoi(status)
 	if err != nil || r.StatusCode < 0 {
-		return errors.New("Invalid HTTP status code: " + string(r.StatusCode))
+		return errors.New("Invalid HTTP status code: " + status)
 	}
 	return nil
 }
 
+// parseContentLength parses a Content-Length value, which may be a list of
+// identical values, RFC 9110 section 8.6
+func parseContentLength(val string) (int64, error) {
+	values := strings.Split(val, ",")
+	n, err := strconv.ParseInt(strings.TrimSpace(values[0]), 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("Invalid Content-Length: " + val)
+	}
+	for _, v := range values[1:] {
+		if m, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err != nil || m != n {
+			return 0, errors.New("Invalid Content-Length: " + val)
+		}
+	}
+	return n, nil
+}
+
 func (handler *responseHandler) readHeader(r *Response) error {
+	transferEncoding := false
 	for {
-		kv, err := readLine(handler.br)
+		kv, crlf, err := readLine(handler.br)
+		if err != nil {
+			// the header section ends with an empty line, EOF before it is a truncated response
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
 		if handler.verbose {
 			fmt.Println(string(kv))
 		}
+		handler.checkLineEnding(kv, crlf)
 		if len(kv) == 0 {
 			break
 		}
+		handler.checkFieldLine(kv)
 		i := bytes.IndexByte(kv, ':')
 		if i < 0 {
 			continue
@@ -278,28 +1010,31 @@ func (handler *responseHandler) readHeader(r *Response) error {
 			i++
 		}
 		val := string(bytes.TrimSpace(kv[i:]))
+		r.Header.Add(key, val)
 		key = strings.ToLower(key)
 		val = strings.ToLower(val)
 		switch key {
 		case "content-length":
-			handler.contentLength, err = strconv.ParseInt(val, 10, 64)
+			if transferEncoding {
+				continue
+			}
+			handler.contentLength, err = parseContentLength(val)
 			if err != nil {
 				return err
 			}
 		case "transfer-encoding":
-			if val != "chunked" {
-				return errors.New("Only support Transfer-Encoding: chunked")
-			}
+			// Transfer-Encoding overrides Content-Length, and the body is
+			// read until the connection closes if chunked is not the final coding
+			transferEncoding = true
+			codings := strings.Split(val, ",")
+			handler.chunked = strings.TrimSpace(codings[len(codings)-1]) == "chunked"
 			handler.contentLength = -1
-			handler.chunked = true
 		case "connection":
 			if val == "close" {
 				handler.shouldCloseConn = true
 			}
-		case "trailer":
-			// RFC 7230, section 4.1.2: Chunked trailer part
-			return errors.New("Chunked trailer part not implement")
 		}
 	}
+	handler.checkFraming(r, handler.version)
 	return nil
 }
@@ -0,0 +1,288 @@
+package myhttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// proxyURL returns the proxy to reach the request host with, or nil to connect directly.
+// The proxy is Client.Proxy if set, otherwise it comes from HTTPS_PROXY, HTTP_PROXY or ALL_PROXY.
+// Hosts matching NO_PROXY are always connected directly.
+func (client *Client) proxyURL(r *request) (*url.URL, error) {
+	proxy := client.Proxy
+	if proxy == "" {
+		if r.useHTTPS {
+			proxy = getEnv("HTTPS_PROXY", "https_proxy")
+		} else {
+			proxy = getEnv("HTTP_PROXY", "http_proxy")
+		}
+		if proxy == "" {
+			proxy = getEnv("ALL_PROXY", "all_proxy")
+		}
+	}
+	if proxy == "" || !useProxy(r.host, r.port, getEnv("NO_PROXY", "no_proxy")) {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %s", proxy, err.Error())
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, errors.New("Unsupported proxy scheme: " + u.Scheme)
+	}
+	return u, nil
+}
+
+func getEnv(names ...string) string {
+	for _, name := range names {
+		if val := os.Getenv(name); val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// useProxy reports whether host:port should be requested through a proxy
+// NO_PROXY is a comma separated list of hosts, domain suffixes, IPs and CIDRs, and "*" matches everything
+func useProxy(host, port, noProxy string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, p := range strings.Split(noProxy, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if p == "*" {
+			return false
+		}
+		if _, cidr, err := net.ParseCIDR(p); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return false
+			}
+			continue
+		}
+		if h, pp, err := net.SplitHostPort(p); err == nil {
+			if pp != port {
+				continue
+			}
+			p = h
+		}
+		if ip != nil {
+			if pip := net.ParseIP(p); pip != nil && pip.Equal(ip) {
+				return false
+			}
+			continue
+		}
+		p = strings.TrimPrefix(p, "*")
+		if host == strings.TrimPrefix(p, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(p, ".")) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialProxy connects to the proxy and, except for plain HTTP through an HTTP proxy,
+// opens a tunnel to the request address
+// It also returns the TCP connection to the proxy, which is under TLS for an https proxy
+func dialProxy(ctx context.Context, d *net.Dialer, network string, proxy *url.URL, r *request) (conn, raw net.Conn, err error) {
+	port := proxy.Port()
+	if port == "" {
+		switch proxy.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	raw, err = d.DialContext(ctx, network, net.JoinHostPort(proxy.Hostname(), port))
+	if err != nil {
+		return nil, nil, err
+	}
+	conn = raw
+	if proxy.Scheme == "https" {
+		conn, err = handshakeTLS(ctx, conn, proxy.Hostname())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(noDeadline)
+	}
+
+	switch proxy.Scheme {
+	case "socks5", "socks5h":
+		err = socks5Connect(ctx, conn, network, proxy, r)
+	default:
+		if !r.useHTTPS {
+			// the request is sent in absolute-form to the proxy itself
+			return conn, raw, nil
+		}
+		err = httpConnect(conn, proxy, r.addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, raw, nil
+}
+
+func proxyAuthorization(proxy *url.URL) string {
+	if proxy.User == nil {
+		return ""
+	}
+	password, _ := proxy.User.Password()
+	auth := proxy.User.Username() + ":" + password
+	return "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(auth)) + "\r\n"
+}
+
+// httpConnect asks an HTTP proxy to open a tunnel to addr with the CONNECT method
+func httpConnect(conn net.Conn, proxy *url.URL, addr string) error {
+	header := fmt.Sprint(
+		"CONNECT "+addr+" HTTP/1.1\r\n",
+		"Host: "+addr+"\r\n",
+		proxyAuthorization(proxy),
+		"\r\n",
+	)
+	if _, err := conn.Write([]byte(header)); err != nil {
+		return err
+	}
+
+	// the proxy sends nothing after its response until the tunnel is used,
+	// so the reader does not buffer any byte of the tunnel
+	handler := &responseHandler{br: bufio.NewReader(conn)}
+	resp := &Response{}
+	if err := handler.readStatusLine(resp); err != nil {
+		return err
+	}
+	if err := handler.readHeader(resp); err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return errors.New("Proxy CONNECT failed: " + resp.Status)
+	}
+	return nil
+}
+
+// socks5Connect implements the CONNECT command of RFC 1928 with the
+// username/password authentication of RFC 1929.
+// socks5h lets the proxy resolve the host, socks5 resolves it locally.
+func socks5Connect(ctx context.Context, conn net.Conn, network string, proxy *url.URL, r *request) error {
+	methods := []byte{0x00}
+	if proxy.User != nil {
+		methods = []byte{0x00, 0x02}
+	}
+	greeting := append([]byte{0x05, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return errors.New("Invalid SOCKS5 version from proxy")
+	}
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if proxy.User == nil {
+			return errors.New("SOCKS5 proxy requires authentication")
+		}
+		user := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return errors.New("SOCKS5 username or password too long")
+		}
+		auth := []byte{0x01, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("SOCKS5 authentication failed")
+		}
+	default:
+		return errors.New("No acceptable SOCKS5 authentication method")
+	}
+
+	host := r.host
+	if proxy.Scheme == "socks5" {
+		ips, err := net.DefaultResolver.LookupIP(ctx, ipNetwork(network), host)
+		if err != nil {
+			return err
+		}
+		host = ips[0].String()
+	}
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("SOCKS5 host name too long")
+		}
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, 0x01)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	}
+	port, err := strconv.Atoi(r.port)
+	if err != nil {
+		return err
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err = io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("SOCKS5 CONNECT failed with code %d", head[1])
+	}
+	// skip the bound address and port
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len + 2
+	case 0x04:
+		skip = net.IPv6len + 2
+	case 0x03:
+		l := make([]byte, 1)
+		if _, err = io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		skip = int(l[0]) + 2
+	default:
+		return errors.New("Invalid SOCKS5 address type")
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
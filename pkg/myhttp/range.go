@@ -0,0 +1,336 @@
+package myhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"mime/multipart"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ByteRange is one range of a Range request, RFC 9110 section 14.1.2
+// Start is -1 for the last End bytes, End is -1 for the bytes from Start to the end
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+func (br ByteRange) String() string {
+	switch {
+	case br.Start < 0:
+		return "-" + strconv.FormatInt(br.End, 10)
+	case br.End < 0:
+		return strconv.FormatInt(br.Start, 10) + "-"
+	default:
+		return strconv.FormatInt(br.Start, 10) + "-" + strconv.FormatInt(br.End, 10)
+	}
+}
+
+// ParseRanges parses a comma separated list of ranges, e.g. 0-99,200-,-500
+// An optional bytes= prefix is ignored
+func ParseRanges(spec string) ([]ByteRange, error) {
+	var ranges []ByteRange
+	for _, s := range strings.Split(strings.TrimPrefix(spec, "bytes="), ",") {
+		s = strings.TrimSpace(s)
+		dash := strings.IndexByte(s, '-')
+		if dash < 0 || s == "-" {
+			return nil, errors.New("Invalid range, want first-last, first- or -suffix: " + s)
+		}
+		br := ByteRange{Start: -1, End: -1}
+		var err error
+		if dash > 0 {
+			if br.Start, err = strconv.ParseInt(s[:dash], 10, 64); err != nil || br.Start < 0 {
+				return nil, errors.New("Invalid range start: " + s)
+			}
+		}
+		if dash < len(s)-1 {
+			if br.End, err = strconv.ParseInt(s[dash+1:], 10, 64); err != nil || br.End < 0 {
+				return nil, errors.New("Invalid range end: " + s)
+			}
+		}
+		if br.Start >= 0 && br.End >= 0 && br.End < br.Start {
+			return nil, errors.New("Invalid range, last before first: " + s)
+		}
+		ranges = append(ranges, br)
+	}
+	return ranges, nil
+}
+
+func rangeHeader(ranges []ByteRange) string {
+	specs := make([]string, len(ranges))
+	for i, br := range ranges {
+		specs[i] = br.String()
+	}
+	return "bytes=" + strings.Join(specs, ",")
+}
+
+// ContentRange is the range sent in a 206 response or body part, RFC 9110 section 14.4
+// Size is the complete length, -1 if unknown
+// Start and End are -1 for the unsatisfied range of a 416 response
+type ContentRange struct {
+	Start int64
+	End   int64
+	Size  int64
+}
+
+func (cr ContentRange) String() string {
+	size := "*"
+	if cr.Size >= 0 {
+		size = strconv.FormatInt(cr.Size, 10)
+	}
+	if cr.Start < 0 {
+		return "bytes */" + size
+	}
+	return fmt.Sprintf("bytes %d-%d/%s", cr.Start, cr.End, size)
+}
+
+// ParseContentRange parses a Content-Range value, bytes first-last/size or bytes */size
+func ParseContentRange(v string) (ContentRange, error) {
+	invalid := errors.New("Invalid Content-Range: " + v)
+	cr := ContentRange{Start: -1, End: -1, Size: -1}
+	if !strings.HasPrefix(v, "bytes ") {
+		return cr, invalid
+	}
+	slash := strings.IndexByte(v, '/')
+	if slash < 0 {
+		return cr, invalid
+	}
+	rng, size := strings.TrimSpace(v[len("bytes "):slash]), v[slash+1:]
+	var err error
+	if size != "*" {
+		if cr.Size, err = strconv.ParseInt(size, 10, 64); err != nil || cr.Size < 0 {
+			return cr, invalid
+		}
+	}
+	if rng == "*" {
+		if cr.Size < 0 {
+			return cr, invalid
+		}
+		return cr, nil
+	}
+	dash := strings.IndexByte(rng, '-')
+	if dash <= 0 {
+		return cr, invalid
+	}
+	if cr.Start, err = strconv.ParseInt(rng[:dash], 10, 64); err != nil || cr.Start < 0 {
+		return cr, invalid
+	}
+	if cr.End, err = strconv.ParseInt(rng[dash+1:], 10, 64); err != nil || cr.End < cr.Start {
+		return cr, invalid
+	}
+	if cr.Size >= 0 && cr.End >= cr.Size {
+		return cr, invalid
+	}
+	return cr, nil
+}
+
+// resolve returns the first and last byte of the range in a representation of size bytes
+// With an unknown size, a range to the end goes to math.MaxInt64 and a suffix range is not ok
+func (br ByteRange) resolve(size int64) (first, last int64, ok bool) {
+	if size < 0 {
+		if br.Start < 0 {
+			return 0, 0, false
+		}
+		if br.End < 0 {
+			return br.Start, math.MaxInt64, true
+		}
+		return br.Start, br.End, true
+	}
+	switch {
+	case br.Start < 0:
+		first, last = size-br.End, size-1
+		if first < 0 {
+			first = 0
+		}
+	case br.End < 0 || br.End >= size:
+		first, last = br.Start, size-1
+	default:
+		first, last = br.Start, br.End
+	}
+	return first, last, first <= last
+}
+
+// The kinds of RangeMismatch
+const (
+	MismatchNoContentRange = "no Content-Range"
+	MismatchContentRange   = "invalid Content-Range"
+	MismatchNotRequested   = "range not requested"
+	MismatchLength         = "wrong body length"
+	MismatchTotal          = "wrong complete length"
+	MismatchMultipart      = "invalid multipart"
+)
+
+// RangeMismatch is why a 206 response does not match the requested ranges,
+// Kind is one of a fixed set and Detail has the values of the response
+type RangeMismatch struct {
+	Kind   string
+	Detail string
+}
+
+func (e *RangeMismatch) Error() string {
+	return e.Kind + ": " + e.Detail
+}
+
+func mismatch(kind, format string, args ...interface{}) *RangeMismatch {
+	return &RangeMismatch{Kind: kind, Detail: fmt.Sprintf(format, args...)}
+}
+
+// checkContentRange checks that cr is within the requested ranges, which the server may coalesce
+func checkContentRange(ranges []ByteRange, cr ContentRange) *RangeMismatch {
+	if cr.Start < 0 {
+		return mismatch(MismatchContentRange, "no range in %s", cr.String())
+	}
+	type interval struct{ first, last int64 }
+	var intervals []interval
+	for _, br := range ranges {
+		first, last, ok := br.resolve(cr.Size)
+		if !ok && cr.Size < 0 && br.Start < 0 {
+			// a suffix range cannot be checked without the complete length
+			return nil
+		}
+		if ok {
+			intervals = append(intervals, interval{first, last})
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].first < intervals[j].first })
+	pos := cr.Start
+	for _, in := range intervals {
+		if in.first <= pos && in.last >= pos {
+			if in.last >= cr.End {
+				return nil
+			}
+			pos = in.last + 1
+		}
+	}
+	return mismatch(MismatchNotRequested, "%s was not requested by %s", cr.String(), rangeHeader(ranges))
+}
+
+// rangeChecker checks a 206 body against the Range of the request as it is written,
+// a single part against Content-Range and each part of a multipart/byteranges body against its own
+type rangeChecker struct {
+	ranges []ByteRange
+	single ContentRange
+	n      int64
+	err    *RangeMismatch
+	// the multipart body is parsed from pw by a goroutine sending its result to done
+	pw   *io.PipeWriter
+	done chan rangeResult
+}
+
+type rangeResult struct {
+	parts []ContentRange
+	err   *RangeMismatch
+}
+
+func newRangeChecker(ranges []ByteRange, header Header) *rangeChecker {
+	rc := &rangeChecker{ranges: ranges}
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == "multipart/byteranges" {
+		if params["boundary"] == "" {
+			rc.err = mismatch(MismatchMultipart, "multipart/byteranges without boundary")
+			return rc
+		}
+		if header.Get("Content-Range") != "" {
+			rc.err = mismatch(MismatchMultipart, "Content-Range in a multipart/byteranges response")
+			return rc
+		}
+		pr, pw := io.Pipe()
+		rc.pw = pw
+		rc.done = make(chan rangeResult, 1)
+		go rc.readParts(pr, params["boundary"])
+		return rc
+	}
+	v := header.Get("Content-Range")
+	if v == "" {
+		rc.err = mismatch(MismatchNoContentRange, "206 response without Content-Range")
+		return rc
+	}
+	var err error
+	if rc.single, err = ParseContentRange(v); err != nil {
+		rc.err = mismatch(MismatchContentRange, "%s", err.Error())
+	} else {
+		rc.err = checkContentRange(ranges, rc.single)
+	}
+	return rc
+}
+
+// Write never fails so the body is still read when it does not match
+func (rc *rangeChecker) Write(p []byte) (int, error) {
+	if rc.pw != nil {
+		rc.pw.Write(p)
+	}
+	rc.n += int64(len(p))
+	return len(p), nil
+}
+
+func (rc *rangeChecker) readParts(pr *io.PipeReader, boundary string) {
+	var res rangeResult
+	mr := multipart.NewReader(pr, boundary)
+	for res.err == nil {
+		i := len(res.parts) + 1
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			if len(res.parts) == 0 {
+				res.err = mismatch(MismatchMultipart, "multipart/byteranges without parts")
+			}
+			break
+		}
+		if err != nil {
+			res.err = mismatch(MismatchMultipart, "part %d: %s", i, err.Error())
+			break
+		}
+		v := part.Header.Get("Content-Range")
+		if v == "" {
+			res.err = mismatch(MismatchNoContentRange, "part %d without Content-Range", i)
+			break
+		}
+		cr, err := ParseContentRange(v)
+		if err != nil {
+			res.err = mismatch(MismatchContentRange, "part %d: %s", i, err.Error())
+			break
+		}
+		n, err := io.Copy(ioutil.Discard, part)
+		if err != nil {
+			res.err = mismatch(MismatchMultipart, "part %d: %s", i, err.Error())
+			break
+		}
+		if want := cr.End - cr.Start + 1; n != want {
+			res.err = mismatch(MismatchLength, "part %d has %d bytes, want %d for %s", i, n, want, cr.String())
+			break
+		}
+		// the parts are ranges of the same representation
+		if len(res.parts) > 0 && cr.Size >= 0 && res.parts[0].Size >= 0 && cr.Size != res.parts[0].Size {
+			res.err = mismatch(MismatchTotal, "part %d is %s, part 1 is %s", i, cr.String(), res.parts[0].String())
+			break
+		}
+		if m := checkContentRange(rc.ranges, cr); m != nil {
+			res.err = mismatch(m.Kind, "part %d: %s", i, m.Detail)
+			break
+		}
+		res.parts = append(res.parts, cr)
+	}
+	// the rest of the body is still written to the pipe
+	io.Copy(ioutil.Discard, pr)
+	rc.done <- res
+}
+
+// finish returns the ranges of the body and the first mismatch found
+func (rc *rangeChecker) finish() ([]ContentRange, *RangeMismatch) {
+	if rc.pw != nil {
+		rc.pw.Close()
+		res := <-rc.done
+		return res.parts, res.err
+	}
+	if rc.err != nil {
+		return nil, rc.err
+	}
+	if want := rc.single.End - rc.single.Start + 1; rc.n != want {
+		return []ContentRange{rc.single}, mismatch(MismatchLength, "body has %d bytes, want %d for %s", rc.n, want, rc.single.String())
+	}
+	return []ContentRange{rc.single}, nil
+}
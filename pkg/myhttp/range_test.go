@@ -0,0 +1,147 @@
+package myhttp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []ByteRange
+	}{
+		{"0-99", []ByteRange{{0, 99}}},
+		{"bytes=0-99,200-, -500", []ByteRange{{0, 99}, {200, -1}, {-1, 500}}},
+		{"5-5", []ByteRange{{5, 5}}},
+		{"", nil},
+		{"-", nil},
+		{"10", nil},
+		{"9-5", nil},
+		{"a-5", nil},
+		{"0-b", nil},
+		{"0-1,", nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseRanges(tt.spec)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("ParseRanges(%q) = %v, want an error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRanges(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+	if got, want := rangeHeader([]ByteRange{{0, 99}, {200, -1}, {-1, 500}}), "bytes=0-99,200-,-500"; got != want {
+		t.Errorf("rangeHeader = %q, want %q", got, want)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ContentRange
+		ok    bool
+	}{
+		{"bytes 0-99/1000", ContentRange{0, 99, 1000}, true},
+		{"bytes 0-99/*", ContentRange{0, 99, -1}, true},
+		{"bytes */1000", ContentRange{-1, -1, 1000}, true},
+		{"bytes 999-999/1000", ContentRange{999, 999, 1000}, true},
+		{"bytes 0-1000/1000", ContentRange{}, false},
+		{"bytes */*", ContentRange{}, false},
+		{"bytes 10-5/100", ContentRange{}, false},
+		{"bytes -5/100", ContentRange{}, false},
+		{"bytes 0-99", ContentRange{}, false},
+		{"items 0-99/1000", ContentRange{}, false},
+		{"bytes 0-99/-1", ContentRange{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseContentRange(tt.value)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("ParseContentRange(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseContentRange(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+		if got.String() != tt.value {
+			t.Errorf("ContentRange.String() = %q, want %q", got.String(), tt.value)
+		}
+	}
+}
+
+func TestCheckContentRange(t *testing.T) {
+	tests := []struct {
+		ranges string
+		cr     ContentRange
+		kind   string
+	}{
+		{"0-99", ContentRange{0, 99, 1000}, ""},
+		{"0-99", ContentRange{0, 49, 1000}, ""},
+		{"0-99", ContentRange{0, 100, 1000}, MismatchNotRequested},
+		{"0-99", ContentRange{10, 99, 1000}, ""},
+		{"0-2000", ContentRange{0, 999, 1000}, ""},
+		{"900-", ContentRange{900, 999, 1000}, ""},
+		{"900-", ContentRange{800, 999, 1000}, MismatchNotRequested},
+		{"-100", ContentRange{900, 999, 1000}, ""},
+		{"-100", ContentRange{899, 999, 1000}, MismatchNotRequested},
+		{"-100", ContentRange{0, 10, -1}, ""},
+		{"0-99,100-199", ContentRange{0, 199, 1000}, ""},
+		{"100-199,0-99", ContentRange{0, 199, 1000}, ""},
+		{"0-99,101-199", ContentRange{0, 199, 1000}, MismatchNotRequested},
+		{"0-99", ContentRange{-1, -1, 1000}, MismatchContentRange},
+	}
+	for _, tt := range tests {
+		ranges, err := ParseRanges(tt.ranges)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kind := ""
+		if m := checkContentRange(ranges, tt.cr); m != nil {
+			kind = m.Kind
+		}
+		if kind != tt.kind {
+			t.Errorf("checkContentRange(%s, %s) = %q, want %q", tt.ranges, tt.cr, kind, tt.kind)
+		}
+	}
+}
+
+func TestRangeChecker(t *testing.T) {
+	multipart := "--b\r\nContent-Range: bytes 0-1/10\r\n\r\nab\r\n--b\r\nContent-Range: bytes 8-9/10\r\n\r\nij\r\n--b--\r\n"
+	tests := []struct {
+		name   string
+		header Header
+		body   string
+		kind   string
+	}{
+		{"single", Header{{Name: "Content-Range", Value: "bytes 0-1/10"}}, "ab", ""},
+		{"short body", Header{{Name: "Content-Range", Value: "bytes 0-1/10"}}, "a", MismatchLength},
+		{"no Content-Range", nil, "ab", MismatchNoContentRange},
+		{"invalid Content-Range", Header{{Name: "Content-Range", Value: "bytes 0-1"}}, "ab", MismatchContentRange},
+		{"multipart", Header{{Name: "Content-Type", Value: "multipart/byteranges; boundary=b"}}, multipart, ""},
+		{"multipart without boundary", Header{{Name: "Content-Type", Value: "multipart/byteranges"}}, multipart, MismatchMultipart},
+		{"multipart part not requested", Header{{Name: "Content-Type", Value: "multipart/byteranges; boundary=b"}},
+			strings.Replace(multipart, "8-9/10", "6-7/10", 1), MismatchNotRequested},
+		{"multipart part length", Header{{Name: "Content-Type", Value: "multipart/byteranges; boundary=b"}},
+			strings.Replace(multipart, "ij", "i", 1), MismatchLength},
+		{"multipart complete length", Header{{Name: "Content-Type", Value: "multipart/byteranges; boundary=b"}},
+			strings.Replace(multipart, "8-9/10", "8-9/11", 1), MismatchTotal},
+	}
+	ranges := []ByteRange{{0, 1}, {-1, 2}}
+	for _, tt := range tests {
+		rc := newRangeChecker(ranges, tt.header)
+		rc.Write([]byte(tt.body))
+		_, m := rc.finish()
+		kind := ""
+		if m != nil {
+			kind = m.Kind
+		}
+		if kind != tt.kind {
+			t.Errorf("%s: mismatch %v, want %q", tt.name, m, tt.kind)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package myhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// ParseResolve parses curl style --resolve entries, host:port:addr[,addr]...
+// The returned map is keyed by host:port, where host and port can be *
+func ParseResolve(entries []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, errors.New("Invalid resolve entry, want host:port:addr: " + entry)
+		}
+		addr := strings.Split(parts[2], ",")[0]
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if net.ParseIP(addr) == nil {
+			return nil, errors.New("Invalid address in resolve entry: " + entry)
+		}
+		m[strings.ToLower(parts[0])+":"+parts[1]] = addr
+	}
+	return m, nil
+}
+
+// ParseConnectTo parses curl style --connect-to entries, host1:port1:host2:port2
+// An empty host1 or port1 matches any host or port, an empty host2 or port2 keeps the original one
+// The returned map is keyed by host1:port1 with * for the empty parts
+func ParseConnectTo(entries []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, entry := range entries {
+		parts, err := splitHostPorts(entry)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < 2; i++ {
+			if parts[i] == "" {
+				parts[i] = "*"
+			}
+		}
+		m[strings.ToLower(parts[0])+":"+parts[1]] = net.JoinHostPort(parts[2], parts[3])
+	}
+	return m, nil
+}
+
+// splitHostPorts splits host1:port1:host2:port2 where the hosts may be bracketed IPv6 addresses
+func splitHostPorts(entry string) ([]string, error) {
+	var parts []string
+	rest := entry
+	for i := 0; i < 4; i++ {
+		if strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errors.New("Invalid connect-to entry: " + entry)
+			}
+			parts = append(parts, rest[1:end])
+			rest = rest[end+1:]
+			if i < 3 {
+				rest = strings.TrimPrefix(rest, ":")
+			}
+			continue
+		}
+		if i == 3 {
+			parts = append(parts, rest)
+			break
+		}
+		colon := strings.IndexByte(rest, ':')
+		if colon < 0 {
+			return nil, errors.New("Invalid connect-to entry, want host1:port1:host2:port2: " + entry)
+		}
+		parts = append(parts, rest[:colon])
+		rest = rest[colon+1:]
+	}
+	return parts, nil
+}
+
+// lookupOverride returns the value in m for host:port, host:* or *:port
+func lookupOverride(m map[string]string, host, port string) (string, bool) {
+	host = strings.ToLower(host)
+	for _, key := range []string{host + ":" + port, host + ":*", "*:" + port, "*:*"} {
+		if val, ok := m[key]; ok {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+// dialAddr returns the address connect dials for the request
+// ConnectTo is applied first and then Resolve or IP to the resulting host
+func (client *Client) dialAddr(r *request) string {
+	host, port := client.connectTo(r.host, r.port)
+	if client.IP != "" {
+		host = client.IP
+	} else if ip, ok := lookupOverride(client.Resolve, host, port); ok {
+		host = ip
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func (client *Client) connectTo(host, port string) (string, string) {
+	if to, ok := lookupOverride(client.ConnectTo, host, port); ok {
+		toHost, toPort, _ := net.SplitHostPort(to)
+		if toHost != "" {
+			host = toHost
+		}
+		if toPort != "" {
+			port = toPort
+		}
+	}
+	return host, port
+}
+
+// LookupIPs returns all the addresses the host of the url resolves to
+// with the client resolver and network, after applying ConnectTo and Resolve
+func (client *Client) LookupIPs(url string) ([]string, error) {
+	r, err := client.newRequest(&Request{URL: url}, false)
+	if err != nil {
+		return nil, err
+	}
+	host, port := client.connectTo(r.host, r.port)
+	if ip, ok := lookupOverride(client.Resolve, host, port); ok {
+		return []string{ip}, nil
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	resolver := client.resolver()
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addrs, err := resolver.LookupIP(ctx, ipNetwork(client.network()), host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.String()
+	}
+	return ips, nil
+}
+
+// ipNetwork returns the network for net.Resolver.LookupIP matching the tcp network
+func ipNetwork(network string) string {
+	return strings.Replace(network, "tcp", "ip", 1)
+}
+
+// resolver returns a resolver querying DNSServer, or nil for the default resolver
+func (client *Client) resolver() *net.Resolver {
+	if client.DNSServer == "" {
+		return nil
+	}
+	server := client.DNSServer
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(server, "["), "]"), "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := &net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
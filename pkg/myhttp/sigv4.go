@@ -0,0 +1,144 @@
+package myhttp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSSigner signs the requests with AWS Signature Version 4
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+type AWSSigner struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Region       string
+	Service      string
+	// now is time.Now if nil
+	now func() time.Time
+}
+
+// unsignedHeaders are not signed as proxies and clients may change them
+var unsignedHeaders = map[string]bool{"user-agent": true, "expect": true, "authorization": true}
+
+// Sign implements Signer
+func (s *AWSSigner) Sign(r *SignRequest) error {
+	now := s.now
+	if now == nil {
+		now = time.Now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash, err := bodyHash(sha256.New, r.Body, r.BodyFile)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("X-Amz-Date", amzDate)
+	if s.Service == "s3" {
+		r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if s.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	// canonical headers, lowercase names sorted with the values of repeated fields joined by commas
+	values := make(map[string][]string)
+	for _, f := range *r.Header {
+		name := strings.ToLower(f.Name)
+		if unsignedHeaders[name] {
+			continue
+		}
+		values[name] = append(values[name], strings.Join(strings.Fields(f.Value), " "))
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(values[name], ",") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// S3 expects the path encoded once, the other services encode the escaped path again
+	path := r.URL.EscapedPath()
+	if s.Service == "s3" {
+		path = r.URL.Path
+	}
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		awsEscapePath(path),
+		awsCanonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+	return nil
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes all but the unreserved characters, with uppercase hex digits
+func awsEscape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// awsEscapePath encodes each segment of the path
+func awsEscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func awsCanonicalQuery(query map[string][]string) string {
+	pairs := []string{}
+	for name, vals := range query {
+		for _, val := range vals {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(val))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
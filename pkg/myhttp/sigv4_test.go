@@ -0,0 +1,113 @@
+package myhttp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestAWSSignerSuite checks the signatures of requests of the AWS Signature Version 4 test suite
+// https://docs.aws.amazon.com/general/latest/gr/signature-v4-test-suite.html
+func TestAWSSignerSuite(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		header Header
+		body   string
+		want   string
+	}{
+		{
+			name:   "get-vanilla",
+			method: "GET",
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "get-vanilla-empty-query-key",
+			method: "GET",
+			url:    "https://example.amazonaws.com/?Param1=value1",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			method: "GET",
+			url:    "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:   "post-vanilla",
+			method: "POST",
+			url:    "https://example.amazonaws.com/",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:   "post-x-www-form-urlencoded",
+			method: "POST",
+			url:    "https://example.amazonaws.com/",
+			header: Header{{Name: "Content-Type", Value: "application/x-www-form-urlencoded"}},
+			body:   "Param1=value1",
+			want:   "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+	signer := &AWSSigner{
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:    "us-east-1",
+		Service:   "service",
+		now:       func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := append(Header{{Name: "Host", Value: u.Host}, {Name: "User-Agent", Value: "ngoperf"}}, tt.header...)
+			r := &SignRequest{Method: tt.method, URL: u, Header: &header, Body: []byte(tt.body)}
+			if err = signer.Sign(r); err != nil {
+				t.Fatal(err)
+			}
+			if got := header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %q, want 20150830T123600Z", got)
+			}
+			if got := header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWSSignerS3(t *testing.T) {
+	header := Header{{Name: "Host", Value: "bucket.s3.amazonaws.com"}}
+	u, _ := url.Parse("https://bucket.s3.amazonaws.com/a%20b.txt")
+	signer := &AWSSigner{AccessKey: "AKIDEXAMPLE", SecretKey: "secret", Region: "us-east-1", Service: "s3",
+		now: func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }}
+	if err := signer.Sign(&SignRequest{Method: "GET", URL: u, Header: &header}); err != nil {
+		t.Fatal(err)
+	}
+	// the hash of the empty body
+	want := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got := header.Get("X-Amz-Content-Sha256"); got != want {
+		t.Errorf("X-Amz-Content-Sha256 = %q, want %q", got, want)
+	}
+}
+
+func TestAWSEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"abcXYZ019-_.~", "abcXYZ019-_.~"},
+		{"a b", "a%20b"},
+		{"a+b=c&d", "a%2Bb%3Dc%26d"},
+		{"é/", "%C3%A9%2F"},
+	}
+	for _, tt := range tests {
+		if got := awsEscape(tt.in); got != tt.want {
+			t.Errorf("awsEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got, want := awsEscapePath("/a b/c%20d"), "/a%20b/c%2520d"; got != want {
+		t.Errorf("awsEscapePath = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+package myhttp
+
+import (
+	"syscall"
+)
+
+// control sets the socket options of Client before the socket connects
+// TCP_NODELAY is set by Go once connected, so Nagle is applied by connect
+func (client *Client) control(network, address string, c syscall.RawConn) error {
+	var err error
+	ctrlErr := c.Control(func(fd uintptr) {
+		if client.ReadBuffer > 0 {
+			if err = setsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, client.ReadBuffer); err != nil {
+				return
+			}
+		}
+		if client.WriteBuffer > 0 {
+			if err = setsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF, client.WriteBuffer); err != nil {
+				return
+			}
+		}
+		if network == "unix" {
+			return
+		}
+		if client.ResetOnClose {
+			err = setsockoptLinger(fd, 0)
+		} else if client.Linger > 0 {
+			err = setsockoptLinger(fd, client.Linger)
+		}
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
+
+// hasSocketOptions reports whether control has to be set on the dialer
+func (client *Client) hasSocketOptions() bool {
+	return client.ReadBuffer > 0 || client.WriteBuffer > 0 || client.ResetOnClose || client.Linger > 0
+}
@@ -0,0 +1,153 @@
+package myhttp
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Warning is a protocol violation found in a response when Client.Strict is set
+type Warning struct {
+	Rule   string
+	RFC    string
+	Detail string
+}
+
+func (w Warning) String() string {
+	return w.Rule + " (" + w.RFC + "): " + w.Detail
+}
+
+// The rules checked in strict mode
+const (
+	RuleBareLF            = "bare-lf"
+	RuleStatusLine        = "invalid-status-line"
+	RuleObsFold           = "obs-fold"
+	RuleFieldLine         = "invalid-field-line"
+	RuleSpaceBeforeColon  = "space-before-colon"
+	RuleFieldName         = "invalid-field-name"
+	RuleFieldValue        = "invalid-field-value"
+	RuleInvalidCL         = "invalid-content-length"
+	RuleConflictingCL     = "conflicting-content-length"
+	RuleCLWithTE          = "content-length-with-transfer-encoding"
+	RuleChunkedNotFinal   = "chunked-not-final"
+	RuleTEInHTTP10        = "transfer-encoding-in-http10"
+	RuleLengthWithoutBody = "length-without-body"
+	RuleChunkLine         = "invalid-chunk-line"
+	RuleTrailerNotChunked = "trailer-without-chunked"
+)
+
+var (
+	statusLineRe = regexp.MustCompile(`^HTTP/[0-9]\.[0-9] [0-9]{3} [\t !-~\x80-\xff]*$`)
+	tokenRe      = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+)
+
+func (handler *responseHandler) warn(rule, rfc, detail string) {
+	if handler.resp != nil {
+		handler.resp.Warnings = append(handler.resp.Warnings, Warning{Rule: rule, RFC: rfc, Detail: detail})
+	}
+}
+
+// checkLineEnding warns about a line ended by LF only, RFC 9112 section 2.2
+func (handler *responseHandler) checkLineEnding(line []byte, crlf bool) {
+	if handler.strict && !crlf {
+		handler.warn(RuleBareLF, "RFC 9112 section 2.2", "line ends with a bare LF: "+quote(line))
+	}
+}
+
+// checkStatusLine checks status-line = HTTP-version SP status-code SP [ reason-phrase ]
+func (handler *responseHandler) checkStatusLine(line string) {
+	if handler.strict && !statusLineRe.MatchString(line) {
+		handler.warn(RuleStatusLine, "RFC 9112 section 4", quote([]byte(line)))
+	}
+}
+
+// checkFieldLine checks field-line = field-name ":" OWS field-value OWS
+func (handler *responseHandler) checkFieldLine(kv []byte) {
+	if !handler.strict {
+		return
+	}
+	if kv[0] == ' ' || kv[0] == '\t' {
+		handler.warn(RuleObsFold, "RFC 9112 section 5.2", "obsolete line folding: "+quote(kv))
+		return
+	}
+	i := strings.IndexByte(string(kv), ':')
+	if i < 0 {
+		handler.warn(RuleFieldLine, "RFC 9112 section 5", "no colon in field line: "+quote(kv))
+		return
+	}
+	name := string(kv[:i])
+	if strings.TrimRight(name, " \t") != name {
+		handler.warn(RuleSpaceBeforeColon, "RFC 9112 section 5.1", "whitespace between field name and colon: "+quote(kv))
+		name = strings.TrimRight(name, " \t")
+	}
+	if !tokenRe.MatchString(name) {
+		handler.warn(RuleFieldName, "RFC 9110 section 5.1", "field name is not a token: "+quote(kv))
+	}
+	for _, b := range kv[i+1:] {
+		if b < ' ' && b != '\t' || b == 0x7f {
+			handler.warn(RuleFieldValue, "RFC 9110 section 5.5", "control character in field value: "+quote(kv))
+			break
+		}
+	}
+}
+
+// checkFraming checks the fields deciding the message body length, RFC 9112 section 6
+func (handler *responseHandler) checkFraming(r *Response, version string) {
+	if !handler.strict {
+		return
+	}
+	lengths := []string{}
+	for _, v := range r.Header.Values("Content-Length") {
+		for _, l := range strings.Split(v, ",") {
+			l = strings.TrimSpace(l)
+			if l == "" || strings.Trim(l, "0123456789") != "" {
+				handler.warn(RuleInvalidCL, "RFC 9110 section 8.6", "Content-Length is not a non-negative integer: "+quote([]byte(v)))
+				continue
+			}
+			lengths = append(lengths, strings.TrimLeft(l, "0"))
+		}
+	}
+	for i := 1; i < len(lengths); i++ {
+		if lengths[i] != lengths[0] {
+			handler.warn(RuleConflictingCL, "RFC 9112 section 6.3", "conflicting Content-Length values: "+strings.Join(r.Header.Values("Content-Length"), ", "))
+			break
+		}
+	}
+
+	te := r.Header.Values("Transfer-Encoding")
+	if len(te) > 0 && len(r.Header.Values("Content-Length")) > 0 {
+		handler.warn(RuleCLWithTE, "RFC 9112 section 6.1", "Content-Length sent with Transfer-Encoding")
+	}
+	if len(te) > 0 && version == "HTTP/1.0" {
+		handler.warn(RuleTEInHTTP10, "RFC 9112 section 6.1", "Transfer-Encoding in an HTTP/1.0 response")
+	}
+	codings := []string{}
+	for _, v := range te {
+		for _, c := range strings.Split(v, ",") {
+			codings = append(codings, strings.ToLower(strings.TrimSpace(c)))
+		}
+	}
+	for i, c := range codings {
+		if c == "chunked" && i != len(codings)-1 {
+			handler.warn(RuleChunkedNotFinal, "RFC 9112 section 6.1", "chunked is not the final transfer coding: "+strings.Join(te, ", "))
+			break
+		}
+	}
+
+	// the trailer section is only sent after a chunked body
+	if len(r.Header.Values("Trailer")) > 0 && !handler.chunked {
+		handler.warn(RuleTrailerNotChunked, "RFC 9110 section 6.6.2", "Trailer announced without chunked transfer coding: "+strings.Join(r.Header.Values("Trailer"), ", "))
+	}
+
+	if (r.StatusCode/100 == 1 || r.StatusCode == 204) && (len(te) > 0 || len(r.Header.Values("Content-Length")) > 0) {
+		handler.warn(RuleLengthWithoutBody, "RFC 9110 section 8.6", r.Status+" response with Content-Length or Transfer-Encoding")
+	}
+}
+
+func quote(b []byte) string {
+	const maxLen = 80
+	if len(b) > maxLen {
+		b = b[:maxLen]
+	}
+	return strconv.Quote(string(b))
+}
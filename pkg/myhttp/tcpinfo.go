@@ -0,0 +1,9 @@
+package myhttp
+
+// TCPInfo is the kernel state of the TCP connection after a request
+type TCPInfo struct {
+	RTT         uint32 // smoothed round trip time in microseconds
+	RTTVar      uint32 // round trip time variance in microseconds
+	Retransmits uint32 // total retransmitted segments
+	Cwnd        uint32 // congestion window in segments
+}
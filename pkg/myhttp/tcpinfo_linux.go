@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package myhttp
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// readTCPInfo reads TCP_INFO from the socket of conn
+func readTCPInfo(conn net.Conn) (*TCPInfo, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("TCP_INFO needs a TCP connection")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var info *unix.TCPInfo
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		info, sockErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sockErr != nil {
+		return nil, sockErr
+	}
+	return &TCPInfo{
+		RTT:         info.Rtt,
+		RTTVar:      info.Rttvar,
+		Retransmits: info.Total_retrans,
+		Cwnd:        info.Snd_cwnd,
+	}, nil
+}
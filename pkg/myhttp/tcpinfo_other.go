@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package myhttp
+
+import (
+	"errors"
+	"net"
+)
+
+func readTCPInfo(conn net.Conn) (*TCPInfo, error) {
+	return nil, errors.New("TCP_INFO is only supported on Linux")
+}
@@ -0,0 +1,110 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ngoperf/pkg/myhttp"
+)
+
+// placeholder matches {{name}} with optional spaces around the name, and the raw form {{{name}}}
+// which only differs in urls, see expandURL
+var placeholder = regexp.MustCompile(`{{{\s*([A-Za-z0-9_.-]+)\s*}}}|{{\s*([A-Za-z0-9_.-]+)\s*}}`)
+
+// placeholderName returns the name of the placeholder match m of s,
+// the indexes of FindStringSubmatchIndex, and whether it has the raw form
+func placeholderName(s string, m []int) (string, bool) {
+	if m[2] >= 0 {
+		return s[m[2]:m[3]], true
+	}
+	return s[m[4]:m[5]], false
+}
+
+// expand replaces the {{name}} placeholders of s by the variables, unknown names are left as they are
+func expand(s string, vars map[string]string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		name, _ := placeholderName(m, placeholder.FindStringSubmatchIndex(m))
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// capture returns the value the capture takes from the response
+func (c *Capture) capture(re *regexp.Regexp, rec *myhttp.Response) (string, error) {
+	source := rec.ResponseBody
+	if c.Header != "" {
+		values := rec.Header.Values(c.Header)
+		if len(values) == 0 {
+			return "", fmt.Errorf("no %s header", c.Header)
+		}
+		source = values[0]
+		// a regex picks one of the values, e.g. one of several Set-Cookie
+		if re != nil {
+			source = strings.Join(values, "\n")
+		}
+	}
+	if c.JSON != "" {
+		return jsonPath(source, c.JSON)
+	}
+	if re == nil {
+		return source, nil
+	}
+	m := re.FindStringSubmatch(source)
+	if m == nil {
+		return "", fmt.Errorf("no match for %s", c.Regex)
+	}
+	if len(m) > 1 {
+		return m[1], nil
+	}
+	return m[0], nil
+}
+
+// jsonPath returns the value at a dot path like data.items.0.id or $.data.items[0].id,
+// strings as they are and the other values as JSON
+func jsonPath(body, path string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return "", errors.New("body is not JSON")
+	}
+	return jsonLookup(v, path)
+}
+
+// jsonLookup returns the value at the path of the decoded JSON value v, see jsonPath
+func jsonLookup(v interface{}, path string) (string, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[key]; !ok {
+				return "", fmt.Errorf("no %s in the JSON", key)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("no index %s in the JSON", key)
+			}
+			v = node[i]
+		default:
+			return "", fmt.Errorf("no %s in the JSON", key)
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,411 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"ngoperf/pkg/myhttp"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// CompareOptions are the settings of CompareRuns
+type CompareOptions struct {
+	// Alpha is the significance level of the tests, the confidence intervals are at 1-Alpha
+	Alpha float64
+	// Threshold is the min slowdown in percent of the median or p95 TTFB counted as a regression
+	Threshold float64
+	// SuccessThreshold is the min drop in points of the success rate counted as a regression
+	SuccessThreshold float64
+	// Resamples is the number of bootstrap resamples of the confidence intervals
+	Resamples int
+}
+
+// runSample is what CompareRuns compares of a run or of one of its targets
+type runSample struct {
+	count   int
+	success int
+	// notModified counts 304 as a success, for the runs that revalidate
+	notModified bool
+	// ttfb of the responses, sorted
+	ttfb   []int64
+	errors map[string]int
+}
+
+func newRunSample(run *SavedRun, recs []record) *runSample {
+	s := &runSample{errors: make(map[string]int), notModified: run.Meta.Options.Revalidate}
+	for _, rec := range recs {
+		s.add(rec.Response)
+	}
+	sort.Slice(s.ttfb, func(i, j int) bool { return s.ttfb[i] < s.ttfb[j] })
+	return s
+}
+
+func (s *runSample) add(rec *myhttp.Response) {
+	s.count++
+	if rec.StatusCode/100 == 2 || s.notModified && rec.StatusCode == 304 {
+		s.success++
+	} else {
+		s.errors[errorClass(rec)]++
+	}
+	if rec.StatusCode > 0 {
+		s.ttfb = append(s.ttfb, rec.TTFB)
+	}
+}
+
+func (s *runSample) successRate() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return float64(s.success) / float64(s.count)
+}
+
+// errorClass returns the class of a failed request: the class of its status code,
+// or the kind of error that stopped it, as the error messages carry addresses and ports
+func errorClass(rec *myhttp.Response) string {
+	if rec.StatusCode > 0 {
+		return fmt.Sprintf("%dxx", rec.StatusCode/100)
+	}
+	msg := strings.ToLower(rec.Status)
+	switch {
+	case rec.Status == desyncStatus:
+		return desyncStatus
+	case strings.Contains(msg, "timeout"):
+		return "timeout"
+	case strings.Contains(msg, "connection refused"):
+		return "connection refused"
+	case strings.Contains(msg, "connection reset"), strings.Contains(msg, "broken pipe"):
+		return "connection reset"
+	case strings.Contains(msg, "no such host"), strings.Contains(msg, "lookup"):
+		return "dns"
+	case strings.Contains(msg, "tls"), strings.Contains(msg, "x509"):
+		return "tls"
+	case strings.Contains(msg, "eof"):
+		return "connection closed"
+	}
+	return "other error"
+}
+
+// mannWhitney returns the two-sided p-value of the Mann-Whitney U test of a against b, both sorted,
+// with the normal approximation corrected for ties, and the probability that a value of b is
+// larger than a value of a, counting the ties as half
+func mannWhitney(a, b []int64) (p float64, probGreater float64) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+	// sum of the ranks of a in the merged samples, ties get their mean rank
+	var rankSumA, ties float64
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var v int64
+		if j >= len(b) || i < len(a) && a[i] <= b[j] {
+			v = a[i]
+		} else {
+			v = b[j]
+		}
+		inA, inB := 0, 0
+		for ; i < len(a) && a[i] == v; i++ {
+			inA++
+		}
+		for ; j < len(b) && b[j] == v; j++ {
+			inB++
+		}
+		t := float64(inA + inB)
+		first := float64(i+j) - t + 1
+		rankSumA += float64(inA) * (first + (t-1)/2)
+		ties += t*t*t - t
+	}
+	u1 := rankSumA - n1*(n1+1)/2
+	probGreater = 1 - u1/(n1*n2)
+
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		return 1, probGreater
+	}
+	diff := math.Abs(u1-mean) - 0.5
+	if diff < 0 {
+		diff = 0
+	}
+	return math.Erfc(diff / math.Sqrt(variance) / math.Sqrt2), probGreater
+}
+
+// twoProportions returns the two-sided p-value of the z-test of the success rates of a and b
+func twoProportions(a, b *runSample) float64 {
+	pooled := float64(a.success+b.success) / float64(a.count+b.count)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(a.count) + 1/float64(b.count)))
+	if se == 0 {
+		return 1
+	}
+	z := (a.successRate() - b.successRate()) / se
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// bootstrapDeltas returns the confidence intervals at 1-alpha of the differences b-a of the percentiles,
+// from resamples of a and b drawn with replacement
+func bootstrapDeltas(a, b []int64, qs []int, resamples int, alpha float64) [][2]float64 {
+	rnd := rand.New(rand.NewSource(1))
+	deltas := make([][]float64, len(qs))
+	countsA, countsB := make([]int, len(a)), make([]int, len(b))
+	for r := 0; r < resamples; r++ {
+		pa := resamplePercentiles(rnd, a, countsA, qs)
+		pb := resamplePercentiles(rnd, b, countsB, qs)
+		for k := range qs {
+			deltas[k] = append(deltas[k], float64(pb[k]-pa[k]))
+		}
+	}
+	cis := make([][2]float64, len(qs))
+	for k := range qs {
+		sort.Float64s(deltas[k])
+		lo := int(math.Floor(alpha / 2 * float64(resamples)))
+		hi := int(math.Ceil((1-alpha/2)*float64(resamples))) - 1
+		if hi >= resamples {
+			hi = resamples - 1
+		}
+		cis[k] = [2]float64{deltas[k][lo], deltas[k][hi]}
+	}
+	return cis
+}
+
+// resamplePercentiles draws len(sorted) values of sorted with replacement and returns their percentiles,
+// counting the draws of each index instead of sorting the resample
+func resamplePercentiles(rnd *rand.Rand, sorted []int64, counts []int, qs []int) []int64 {
+	n := len(sorted)
+	for i := range counts {
+		counts[i] = 0
+	}
+	for i := 0; i < n; i++ {
+		counts[rnd.Intn(n)]++
+	}
+	result := make([]int64, len(qs))
+	for k, q := range qs {
+		rank := (q*n + 99) / 100
+		if rank < 1 {
+			rank = 1
+		}
+		seen := 0
+		for i, c := range counts {
+			seen += c
+			if seen >= rank {
+				result[k] = sorted[i]
+				break
+			}
+		}
+	}
+	return result
+}
+
+func average(values []int64) float64 {
+	var sum int64
+	for _, v := range values {
+		sum += v
+	}
+	return float64(sum) / float64(len(values))
+}
+
+// percentChange returns the change from a to b in percent of a
+func percentChange(a, b float64) float64 {
+	if a == 0 {
+		if b == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (b - a) / a * 100
+}
+
+func formatPercent(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+inf"
+	}
+	return fmt.Sprintf("%+.1f %%", v)
+}
+
+// CompareRuns prints the differences of TTFB percentiles, success rate and errors from run a to run b,
+// with the tests telling them from noise, and returns the regressions found in b, if any
+func CompareRuns(a, b *SavedRun, opts CompareOptions) ([]string, error) {
+	for _, run := range []*SavedRun{a, b} {
+		if len(run.records) == 0 {
+			return nil, errors.New("No request in " + run.Name)
+		}
+	}
+	sa, sb := newRunSample(a, a.records), newRunSample(b, b.records)
+	fmt.Printf("A: %s, %s requests with %d workers, started %s\n", a.Name, prettyInt(sa.count), a.Meta.Options.NumWorker, a.Meta.Start.Format("2006-01-02 15:04:05"))
+	fmt.Printf("B: %s, %s requests with %d workers, started %s\n", b.Name, prettyInt(sb.count), b.Meta.Options.NumWorker, b.Meta.Start.Format("2006-01-02 15:04:05"))
+	if a.Meta.Options.NumWorker != b.Meta.Options.NumWorker || a.Meta.Options.Pipeline != b.Meta.Options.Pipeline {
+		fmt.Println("Note: the runs did not use the same workers and pipeline, their times may not be comparable")
+	}
+
+	var regressions []string
+	if len(sa.ttfb) > 0 && len(sb.ttfb) > 0 {
+		regressions = append(regressions, compareTTFB(sa, sb, opts)...)
+	} else {
+		fmt.Println("\nNo response in one of the runs, the time to first byte is not compared")
+	}
+	regressions = append(regressions, compareSuccess(sa, sb, opts)...)
+	if len(sa.errors) > 0 || len(sb.errors) > 0 {
+		printErrorClassDeltas(sa, sb)
+	}
+	compareTargets(a, b)
+
+	fmt.Println()
+	if len(regressions) == 0 {
+		fmt.Println("No regression detected")
+	}
+	for _, r := range regressions {
+		fmt.Println("Regression: " + r)
+	}
+	return regressions, nil
+}
+
+func compareTTFB(sa, sb *runSample, opts CompareOptions) []string {
+	qs := []int{50, 75, 90, 95, 99}
+	cis := bootstrapDeltas(sa.ttfb, sb.ttfb, qs, opts.Resamples, opts.Alpha)
+	level := fmt.Sprintf("%g%% ci of delta", (1-opts.Alpha)*100)
+
+	fmt.Println("\nThe Time to First Byte (ms):")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"metric", "A", "B", "delta", "delta %", level})
+	table.SetAutoWrapText(false)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	var regressions []string
+	for k, q := range qs {
+		pa, pb := percentile(sa.ttfb, q), percentile(sb.ttfb, q)
+		change := percentChange(float64(pa), float64(pb))
+		data := []string{fmt.Sprintf("p%d", q), prettyInt64(pa), prettyInt64(pb), fmt.Sprintf("%+d", pb-pa),
+			formatPercent(change), fmt.Sprintf("[%+g, %+g]", cis[k][0], cis[k][1])}
+		// the tail is not covered by the rank test, its interval must exclude no change
+		if q == 95 && cis[k][0] > 0 && change >= opts.Threshold {
+			regressions = append(regressions, fmt.Sprintf("the p95 time to first byte is %s slower, %s [%+g, %+g]", formatPercent(change), level, cis[k][0], cis[k][1]))
+		}
+		if cis[k][0] > 0 {
+			table.Rich(data, []tablewriter.Colors{{}, {}, {}, {tablewriter.BgRedColor}})
+		} else if cis[k][1] < 0 {
+			table.Rich(data, []tablewriter.Colors{{}, {}, {}, {tablewriter.BgGreenColor}})
+		} else {
+			table.Append(data)
+		}
+	}
+	ma, mb := average(sa.ttfb), average(sb.ttfb)
+	table.Append([]string{"mean", fmt.Sprintf("%.1f", ma), fmt.Sprintf("%.1f", mb), fmt.Sprintf("%+.1f", mb-ma),
+		formatPercent(percentChange(ma, mb)), "-"})
+	table.Render()
+
+	p, probSlower := mannWhitney(sa.ttfb, sb.ttfb)
+	verdict := "no significant difference"
+	if p < opts.Alpha {
+		verdict = "B is faster"
+		if probSlower > 0.5 {
+			verdict = "B is slower"
+		}
+	}
+	fmt.Printf("Mann-Whitney U test: p = %.4g, P(B slower than A) = %.3f, %s at alpha %g\n", p, probSlower, verdict, opts.Alpha)
+	change := percentChange(float64(percentile(sa.ttfb, 50)), float64(percentile(sb.ttfb, 50)))
+	if p < opts.Alpha && probSlower > 0.5 && change >= opts.Threshold {
+		regressions = append([]string{fmt.Sprintf("the median time to first byte is %s slower, Mann-Whitney p = %.4g", formatPercent(change), p)}, regressions...)
+	}
+	return regressions
+}
+
+func compareSuccess(sa, sb *runSample, opts CompareOptions) []string {
+	ra, rb := sa.successRate()*100, sb.successRate()*100
+	p := twoProportions(sa, sb)
+	fmt.Println("\nThe Success Rate:")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"A", "B", "delta (points)", "p-value"})
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	data := []string{fmt.Sprintf("%.2f %%", ra), fmt.Sprintf("%.2f %%", rb), fmt.Sprintf("%+.2f", rb-ra), fmt.Sprintf("%.4g", p)}
+	if p < opts.Alpha && rb < ra {
+		table.Rich(data, []tablewriter.Colors{{}, {}, {tablewriter.BgRedColor}})
+	} else {
+		table.Append(data)
+	}
+	table.Render()
+	if p < opts.Alpha && ra-rb >= opts.SuccessThreshold {
+		return []string{fmt.Sprintf("the success rate dropped by %.2f points, p = %.4g", ra-rb, p)}
+	}
+	return nil
+}
+
+// printErrorClassDeltas prints the share of the requests failing by error class in both runs
+func printErrorClassDeltas(sa, sb *runSample) {
+	fmt.Println("\nThe Errors by Class:")
+	classes := []string{}
+	for c := range sa.errors {
+		classes = append(classes, c)
+	}
+	for c := range sb.errors {
+		if _, ok := sa.errors[c]; !ok {
+			classes = append(classes, c)
+		}
+	}
+	sort.Strings(classes)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"class", "A", "B", "A %", "B %", "delta (points)"})
+	table.SetAutoWrapText(false)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	for _, c := range classes {
+		pa := float64(sa.errors[c]) * 100 / float64(sa.count)
+		pb := float64(sb.errors[c]) * 100 / float64(sb.count)
+		table.Append([]string{c, prettyInt(sa.errors[c]), prettyInt(sb.errors[c]),
+			fmt.Sprintf("%.2f", pa), fmt.Sprintf("%.2f", pb), fmt.Sprintf("%+.2f", pb-pa)})
+	}
+	table.Render()
+}
+
+// compareTargets prints the median TTFB and success rate of the targets found in both runs,
+// matched by method and url, when the runs have more than one target
+func compareTargets(a, b *SavedRun) {
+	if len(a.Meta.Targets) < 2 && len(b.Meta.Targets) < 2 {
+		return
+	}
+	key := func(run *SavedRun, t Target) string {
+		m := t.Method
+		if m == "" {
+			m = run.Meta.Options.Method
+		}
+		return m + " " + t.URL
+	}
+	byKey := func(run *SavedRun) map[string][]record {
+		recs := make(map[string][]record)
+		for _, rec := range run.records {
+			k := key(run, run.Meta.Targets[rec.target])
+			recs[k] = append(recs[k], rec)
+		}
+		return recs
+	}
+	recsA, recsB := byKey(a), byKey(b)
+	keys := []string{}
+	for k := range recsA {
+		if _, ok := recsB[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		fmt.Println("\nNo target in both runs")
+		return
+	}
+	sort.Strings(keys)
+
+	fmt.Println("\nThe Targets in Both Runs:")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"target", "A median", "B median", "delta %", "p-value", "A success", "B success"})
+	table.SetAutoWrapText(false)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT, tablewriter.ALIGN_RIGHT})
+	for _, k := range keys {
+		sa, sb := newRunSample(a, recsA[k]), newRunSample(b, recsB[k])
+		data := []string{k, "-", "-", "-", "-", fmt.Sprintf("%.1f %%", sa.successRate()*100), fmt.Sprintf("%.1f %%", sb.successRate()*100)}
+		if len(sa.ttfb) > 0 && len(sb.ttfb) > 0 {
+			ma, mb := percentile(sa.ttfb, 50), percentile(sb.ttfb, 50)
+			p, _ := mannWhitney(sa.ttfb, sb.ttfb)
+			data[1], data[2] = prettyInt64(ma), prettyInt64(mb)
+			data[3], data[4] = formatPercent(percentChange(float64(ma), float64(mb))), fmt.Sprintf("%.4g", p)
+		}
+		table.Append(data)
+	}
+	table.Render()
+}
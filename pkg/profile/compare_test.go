@@ -0,0 +1,63 @@
+package profile
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	tests := []struct {
+		a, b       []int64
+		p, greater float64
+	}{
+		{[]int64{1, 2, 3, 4, 5}, []int64{6, 7, 8, 9, 10}, 0.0121857804, 1},
+		{[]int64{6, 7, 8, 9, 10}, []int64{1, 2, 3, 4, 5}, 0.0121857804, 0},
+		{[]int64{1, 2, 2, 3}, []int64{2, 3, 3, 4, 5}, 0.0993422479, 0.85},
+		{[]int64{12, 15, 18, 21, 30, 45}, []int64{11, 16, 17, 25, 40, 50, 60}, 0.6170750775, 0.5952380952},
+		{[]int64{10, 20, 30}, []int64{10, 20, 30}, 1, 0.5},
+		// all tied, the variance is 0
+		{[]int64{5, 5, 5}, []int64{5, 5}, 1, 0.5},
+		{[]int64{1}, []int64{2}, 1, 1},
+	}
+	for _, tt := range tests {
+		p, greater := mannWhitney(tt.a, tt.b)
+		if math.Abs(p-tt.p) > 1e-9 || math.Abs(greater-tt.greater) > 1e-9 {
+			t.Errorf("mannWhitney(%v, %v) = %.10f, %.10f, want %.10f, %.10f", tt.a, tt.b, p, greater, tt.p, tt.greater)
+		}
+	}
+}
+
+// TestMannWhitneyU checks the probability of a larger value of b against the count of the pairs
+func TestMannWhitneyU(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 50; n++ {
+		a := make([]int64, 1+rnd.Intn(30))
+		b := make([]int64, 1+rnd.Intn(30))
+		for i := range a {
+			a[i] = rnd.Int63n(20)
+		}
+		for i := range b {
+			b[i] = rnd.Int63n(25)
+		}
+		sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+		sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+		var pairs float64
+		for _, x := range a {
+			for _, y := range b {
+				switch {
+				case y > x:
+					pairs++
+				case y == x:
+					pairs += 0.5
+				}
+			}
+		}
+		want := pairs / float64(len(a)*len(b))
+		p, greater := mannWhitney(a, b)
+		if math.Abs(greater-want) > 1e-9 || p < 0 || p > 1 {
+			t.Fatalf("mannWhitney(%v, %v) = %f, %f, want probability %f", a, b, p, greater, want)
+		}
+	}
+}
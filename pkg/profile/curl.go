@@ -0,0 +1,242 @@
+package profile
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"strings"
+)
+
+// curlIgnored are the curl options with no effect on the request sent, the ones taking a value map to true
+var curlIgnored = map[string]bool{
+	"-s": false, "--silent": false, "-S": false, "--show-error": false, "-k": false, "--insecure": false,
+	"-L": false, "--location": false, "-v": false, "--verbose": false, "-i": false, "--include": false,
+	"--compressed": false, "-f": false, "--fail": false, "-#": false, "--progress-bar": false,
+	"-o": true, "--output": true, "-w": true, "--write-out": true, "-m": true, "--max-time": true,
+	"--connect-timeout": true, "--retry": true, "-c": true, "--cookie-jar": true, "--http1.1": false,
+	"--http2": false, "-O": false, "--remote-name": false,
+}
+
+// ParseCurl returns a one step scenario with the request of a curl command line,
+// given as the arguments after curl or as one string to split like a shell
+func ParseCurl(args []string) (*Scenario, error) {
+	if len(args) == 1 {
+		var err error
+		if args, err = splitShell(args[0]); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) > 0 && (args[0] == "curl" || strings.HasSuffix(args[0], "/curl")) {
+		args = args[1:]
+	}
+
+	step := Step{}
+	var data []string
+	get, head := false, false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := arg, "", false
+		// --name=value and -Xvalue
+		if strings.HasPrefix(arg, "--") {
+			if eq := strings.IndexByte(arg, '='); eq > 0 {
+				name, value, hasValue = arg[:eq], arg[eq+1:], true
+			}
+		} else if strings.HasPrefix(arg, "-") && len(arg) > 2 && curlTakesValue(arg[:2]) {
+			name, value, hasValue = arg[:2], arg[2:], true
+		}
+		if !strings.HasPrefix(arg, "-") {
+			if step.URL != "" {
+				return nil, errors.New("more than one url in the curl command: " + arg)
+			}
+			step.URL = arg
+			continue
+		}
+		if curlTakesValue(name) && !hasValue {
+			if i+1 >= len(args) {
+				return nil, errors.New("no value for curl option " + name)
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "-X", "--request":
+			step.Method = strings.ToUpper(value)
+		case "-H", "--header":
+			colon := strings.IndexByte(value, ':')
+			if colon <= 0 {
+				return nil, errors.New("invalid curl header " + value)
+			}
+			step.addHeader(strings.TrimSpace(value[:colon]), strings.TrimSpace(value[colon+1:]))
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode":
+			if strings.HasPrefix(value, "@") && name != "--data-raw" && name != "--data-urlencode" {
+				b, err := ioutil.ReadFile(value[1:])
+				if err != nil {
+					return nil, err
+				}
+				value = string(b)
+				if name != "--data-binary" {
+					value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+				}
+			}
+			if name == "--data-urlencode" {
+				value = curlURLEncode(value)
+			}
+			data = append(data, value)
+		case "--json":
+			data = append(data, value)
+			step.addHeader("Content-Type", "application/json")
+			step.addHeader("Accept", "application/json")
+		case "-u", "--user":
+			step.addHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(value)))
+		case "-A", "--user-agent":
+			step.addHeader("User-Agent", value)
+		case "-e", "--referer":
+			step.addHeader("Referer", value)
+		case "-b", "--cookie":
+			if !strings.Contains(value, "=") {
+				return nil, errors.New("curl cookie files are not imported, use -b with ngoperf: " + value)
+			}
+			step.addHeader("Cookie", value)
+		case "--url":
+			step.URL = value
+		case "-G", "--get":
+			get = true
+		case "-I", "--head":
+			head = true
+		default:
+			if _, ok := curlIgnored[name]; !ok && !curlIgnoredFlags(name) {
+				return nil, errors.New("unsupported curl option " + name)
+			}
+		}
+	}
+	if step.URL == "" {
+		return nil, errors.New("no url in the curl command")
+	}
+
+	body := strings.Join(data, "&")
+	switch {
+	case get && body != "":
+		sep := "?"
+		if strings.Contains(step.URL, "?") {
+			sep = "&"
+		}
+		step.URL += sep + body
+	case body != "":
+		step.Body = body
+		if step.header("Content-Type") == "" {
+			step.addHeader("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if step.Method == "" {
+		switch {
+		case head:
+			step.Method = "HEAD"
+		case step.Body != "":
+			step.Method = "POST"
+		default:
+			step.Method = "GET"
+		}
+	}
+	return &Scenario{Name: "curl", Steps: []Step{step}}, nil
+}
+
+// curlTakesValue reports whether the curl option is followed by a value
+func curlTakesValue(name string) bool {
+	switch name {
+	case "-X", "--request", "-H", "--header", "-d", "--data", "--data-ascii", "--data-binary", "--data-raw",
+		"--data-urlencode", "--json", "-u", "--user", "-A", "--user-agent", "-e", "--referer", "-b", "--cookie", "--url":
+		return true
+	}
+	return curlIgnored[name]
+}
+
+// curlIgnoredFlags reports whether name is a group of ignored short options like -sSL
+func curlIgnoredFlags(name string) bool {
+	if len(name) < 3 || name[0] != '-' || name[1] == '-' {
+		return false
+	}
+	for _, c := range name[1:] {
+		if takesValue, ok := curlIgnored["-"+string(c)]; !ok || takesValue {
+			return false
+		}
+	}
+	return true
+}
+
+// curlURLEncode encodes a --data-urlencode value, content, =content, name=content or name@file
+func curlURLEncode(v string) string {
+	if eq := strings.IndexByte(v, '='); eq >= 0 {
+		if eq == 0 {
+			return url.QueryEscape(v[1:])
+		}
+		return v[:eq] + "=" + url.QueryEscape(v[eq+1:])
+	}
+	if at := strings.IndexByte(v, '@'); at >= 0 {
+		b, err := ioutil.ReadFile(v[at+1:])
+		if err == nil {
+			v = string(b)
+		}
+		if at == 0 {
+			return url.QueryEscape(v)
+		}
+		return v[:at] + "=" + url.QueryEscape(v)
+	}
+	return url.QueryEscape(v)
+}
+
+// splitShell splits a command line into words like a POSIX shell, with single and double quotes,
+// backslash escapes and line continuations
+func splitShell(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			// a line continuation, also with the CRLF of a command copied on Windows
+			if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+			if s[i] != '\n' {
+				word.WriteByte(s[i])
+				inWord = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated ' in the curl command")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated \" in the curl command")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
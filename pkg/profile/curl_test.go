@@ -0,0 +1,96 @@
+package profile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShell(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"curl https://example.com", []string{"curl", "https://example.com"}},
+		{"  curl\t-s  'a b'  ", []string{"curl", "-s", "a b"}},
+		{`-H 'X-A: it'"'"'s'`, []string{"-H", "X-A: it's"}},
+		{`-d "{\"a\": \"$x\\\"}"`, []string{"-d", `{"a": "$x\"}`}},
+		{`"a\nb"`, []string{`a\nb`}},
+		{`a\ b c\\d`, []string{"a b", `c\d`}},
+		{"curl \\\n  -X POST \\\r\n  url", []string{"curl", "-X", "POST", "url"}},
+		{`'' ""`, []string{"", ""}},
+		{`a'b'"c"d`, []string{"abcd"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := splitShell(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitShell(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{`curl 'abc`, `curl "abc`, `curl "abc\"`} {
+		if got, err := splitShell(in); err == nil {
+			t.Errorf("splitShell(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want Step
+	}{
+		{
+			name: "one string",
+			args: []string{`curl -sSL 'https://example.com/a?b=1' -H 'Accept: text/html' --compressed`},
+			want: Step{Method: "GET", URL: "https://example.com/a?b=1", Headers: map[string]string{"Accept": "text/html"}},
+		},
+		{
+			name: "data",
+			args: []string{"-d", "a=1", "--data-urlencode", "q=x y", "https://example.com/form"},
+			want: Step{Method: "POST", URL: "https://example.com/form", Body: "a=1&q=x+y",
+				Headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}},
+		},
+		{
+			name: "get data",
+			args: []string{"-G", "--data=a=1", "-dq=2", "https://example.com/s?x=0"},
+			want: Step{Method: "GET", URL: "https://example.com/s?x=0&a=1&q=2"},
+		},
+		{
+			name: "json",
+			args: []string{"curl", "-XPUT", "--json", `{"a":1}`, "--url", "https://example.com/j"},
+			want: Step{Method: "PUT", URL: "https://example.com/j", Body: `{"a":1}`,
+				Headers: map[string]string{"Content-Type": "application/json", "Accept": "application/json"}},
+		},
+		{
+			name: "user and head",
+			args: []string{"-I", "-u", "user:pass", "-A", "agent", "-b", "a=1", "https://example.com/"},
+			want: Step{Method: "HEAD", URL: "https://example.com/",
+				Headers: map[string]string{"Authorization": "Basic dXNlcjpwYXNz", "User-Agent": "agent", "Cookie": "a=1"}},
+		},
+	}
+	for _, tt := range tests {
+		sc, err := ParseCurl(tt.args)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(sc.Steps) != 1 || !reflect.DeepEqual(sc.Steps[0], tt.want) {
+			t.Errorf("%s: ParseCurl = %+v, want %+v", tt.name, sc.Steps, tt.want)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"curl -X"},
+		{"-s"},
+		{"https://a.example", "https://b.example"},
+		{"-H", "no colon", "https://example.com"},
+		{"--unknown", "https://example.com"},
+		{"-sSo", "https://example.com"},
+		{"-b", "cookies.txt", "https://example.com"},
+	} {
+		if _, err := ParseCurl(args); err == nil {
+			t.Errorf("ParseCurl(%q) succeeded, want an error", args)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package profile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ngoperf/pkg/myhttp"
+)
+
+// The modes of a data feed
+const (
+	// FeedSequential gives the rows in order and starts again after the last one
+	FeedSequential = "sequential"
+	// FeedRandom gives a random row each time
+	FeedRandom = "random"
+	// FeedUnique gives each row once, the run needs at least one row per request
+	FeedUnique = "unique"
+)
+
+// Feed gives the rows of a CSV or JSONL file to fill the {{column}} placeholders of the requests,
+// it is safe for concurrent use
+type Feed struct {
+	Columns []string
+	rows    []map[string]string
+	mode    string
+	next    uint64
+	mu      sync.Mutex
+	rand    *rand.Rand
+}
+
+// LoadFeed reads a feed file, JSON lines if its name ends with .jsonl or .ndjson and CSV with a header row otherwise
+func LoadFeed(name, mode string) (*Feed, error) {
+	if mode != FeedSequential && mode != FeedRandom && mode != FeedUnique {
+		return nil, errors.New("Invalid feed mode, want sequential, random or unique: " + mode)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	f := &Feed{mode: mode, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	if strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".ndjson") {
+		err = f.readJSONL(file)
+	} else {
+		err = f.readCSV(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	if len(f.rows) == 0 {
+		return nil, errors.New("No row in " + name)
+	}
+	return f, nil
+}
+
+func (f *Feed) readCSV(file *os.File) error {
+	r := csv.NewReader(file)
+	records, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	for _, col := range records[0] {
+		f.Columns = append(f.Columns, strings.TrimSpace(col))
+	}
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(record))
+		for i, v := range record {
+			row[f.Columns[i]] = v
+		}
+		f.rows = append(f.rows, row)
+	}
+	return nil
+}
+
+func (f *Feed) readJSONL(file *os.File) error {
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			return fmt.Errorf("line %d: want a JSON object", n)
+		}
+		row := make(map[string]string, len(obj))
+		for k, v := range obj {
+			if s, ok := v.(string); ok {
+				row[k] = s
+			} else {
+				b, _ := json.Marshal(v)
+				row[k] = string(b)
+			}
+			if !seen[k] {
+				seen[k] = true
+				f.Columns = append(f.Columns, k)
+			}
+		}
+		f.rows = append(f.rows, row)
+	}
+	return scanner.Err()
+}
+
+// Len returns the number of rows
+func (f *Feed) Len() int {
+	return len(f.rows)
+}
+
+// Check returns an error if the feed cannot give n rows
+func (f *Feed) Check(n int) error {
+	if f.mode == FeedUnique && n > len(f.rows) {
+		return fmt.Errorf("The data feed has %d rows, unique mode needs %d", len(f.rows), n)
+	}
+	return nil
+}
+
+// Next returns the row for the next request, in unique mode it returns false when all the rows are used
+func (f *Feed) Next() (map[string]string, bool) {
+	if f.mode == FeedRandom {
+		f.mu.Lock()
+		i := f.rand.Intn(len(f.rows))
+		f.mu.Unlock()
+		return f.rows[i], true
+	}
+	i := atomic.AddUint64(&f.next, 1) - 1
+	if f.mode == FeedUnique && i >= uint64(len(f.rows)) {
+		return nil, false
+	}
+	return f.rows[i%uint64(len(f.rows))], true
+}
+
+// fill returns a copy of the request with the {{column}} placeholders of its url, header and body replaced by the row
+func fill(req *myhttp.Request, row map[string]string) *myhttp.Request {
+	filled := *req
+	filled.URL = expandURL(req.URL, row)
+	filled.Header = make(myhttp.Header, len(req.Header))
+	for i, f := range req.Header {
+		filled.Header[i] = myhttp.HeaderField{Name: f.Name, Value: expand(f.Value, row)}
+	}
+	if len(req.Body) > 0 {
+		filled.Body = []byte(expand(string(req.Body), row))
+	}
+	return &filled
+}
+
+// expandURL is expand with the values percent-encoded, with url.PathEscape before the query
+// and url.QueryEscape in it, so a value is one path segment or one query value whatever it holds
+// The values of the {{{name}}} placeholders are already escaped and are put in the url as they are
+func expandURL(s string, vars map[string]string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	query := strings.IndexByte(s, '?')
+	var sb strings.Builder
+	last := 0
+	for _, m := range placeholder.FindAllStringSubmatchIndex(s, -1) {
+		name, raw := placeholderName(s, m)
+		v, ok := vars[name]
+		if !ok {
+			continue
+		}
+		switch {
+		case raw:
+		case query >= 0 && m[0] > query:
+			v = url.QueryEscape(v)
+		default:
+			v = url.PathEscape(v)
+		}
+		sb.WriteString(s[last:m[0]])
+		sb.WriteString(v)
+		last = m[1]
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
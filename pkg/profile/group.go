@@ -0,0 +1,140 @@
+package profile
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+
+	"ngoperf/pkg/myhttp"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// groupResult is the result of the requests sharing a key, e.g. the same remote IP
+type groupResult struct {
+	count   int
+	success int
+	ttfb    []int64
+	errors  int
+}
+
+func addGroupRecord(groups map[string]*groupResult, key string, rec *myhttp.Response) {
+	g, ok := groups[key]
+	if !ok {
+		g = &groupResult{}
+		groups[key] = g
+	}
+	g.count++
+	if rec.StatusCode == 0 {
+		g.errors++
+		return
+	}
+	if rec.StatusCode/100 == 2 {
+		g.success++
+	}
+	g.ttfb = append(g.ttfb, rec.TTFB)
+}
+
+// printGroupSummary prints one row per group with its success rate, TTFB and errors
+func printGroupSummary(title string, keyName string, groups map[string]*groupResult) {
+	fmt.Println(title)
+	keys := []string{}
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	header := []string{keyName, "requests", "success", "errors", "fast", "slow", "mean", "median"}
+	table.SetHeader(header)
+	table.SetAutoWrapText(false)
+	for _, k := range keys {
+		g := groups[k]
+		data := []string{k, prettyInt(g.count), fmt.Sprintf("%.1f %%", float32(g.success)*100/float32(g.count)), prettyInt(g.errors)}
+		data = append(data, intervalStats(g.ttfb)...)
+		if g.success < g.count {
+			table.Rich(data, []tablewriter.Colors{{}, {}, {tablewriter.BgRedColor}})
+		} else {
+			table.Append(data)
+		}
+	}
+	colors := make([]tablewriter.Colors, len(header))
+	for i := range colors {
+		colors[i] = tablewriter.Colors{tablewriter.Bold}
+	}
+	table.SetHeaderColor(colors...)
+	table.Render()
+}
+
+// printPercentileComparison prints the TTFB percentiles of the groups side by side, one column per group
+func printPercentileComparison(title string, groups map[string]*groupResult) {
+	fmt.Println(title)
+	keys := []string{}
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(append([]string{"percentile"}, keys...))
+	for _, q := range []int{50, 75, 90, 95, 99} {
+		data := []string{fmt.Sprintf("p%d", q)}
+		for _, k := range keys {
+			intervals := groups[k].ttfb
+			if len(intervals) == 0 {
+				data = append(data, "-")
+				continue
+			}
+			sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+			data = append(data, prettyInt64(percentile(intervals, q)))
+		}
+		table.Append(data)
+	}
+	table.Render()
+}
+
+// percentile returns the q-th percentile of sorted with the nearest-rank method
+func percentile(sorted []int64, q int) int64 {
+	rank := (q*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// intervalStats sorts intervals and returns fast, slow, mean and median of them, or "-" if it is empty
+func intervalStats(intervals []int64) []string {
+	n := len(intervals)
+	if n == 0 {
+		return []string{"-", "-", "-", "-"}
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	var sum int64 = 0
+	for _, val := range intervals {
+		sum += val
+	}
+	return []string{prettyInt64(intervals[0]), prettyInt64(intervals[n-1]), prettyInt64(sum / int64(n)), prettyInt64(intervals[n/2])}
+}
+
+// family returns the address family of the record, IPv4 or IPv6
+func family(rec *myhttp.Response) string {
+	switch rec.Network {
+	case "tcp4":
+		return "IPv4"
+	case "tcp6":
+		return "IPv6"
+	}
+	if ip := net.ParseIP(remoteIP(rec.RemoteAddr)); ip != nil && ip.To4() == nil {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// remoteIP returns the ip of a remote or local ip:port address, or addr itself if it has no port
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
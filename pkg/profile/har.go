@@ -0,0 +1,397 @@
+package profile
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ngoperf/pkg/myhttp"
+)
+
+// HAR is an HTTP Archive 1.2 file, http://www.softwareishard.com/blog/har-12-spec/
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of a HAR file
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator is the application that wrote the HAR file
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one request and its response
+type HAREntry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	// Time is the total time of the request in ms, the sum of the timings
+	Time            float64      `json:"time"`
+	Request         HARRequest   `json:"request"`
+	Response        *HARResponse `json:"response,omitempty"`
+	Cache           *struct{}    `json:"cache,omitempty"`
+	Timings         *HARTimings  `json:"timings,omitempty"`
+	ServerIPAddress string       `json:"serverIPAddress,omitempty"`
+	// Connection is the local port of the connection
+	Connection string  `json:"connection,omitempty"`
+	TLS        *HARTLS `json:"_tls,omitempty"`
+}
+
+// HARRequest is the request of an entry
+type HARRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []HARNameVal `json:"cookies"`
+	Headers     []HARNameVal `json:"headers"`
+	QueryString []HARNameVal `json:"queryString"`
+	PostData    *HARPostData `json:"postData,omitempty"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+// HARResponse is the response of an entry
+type HARResponse struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []HARNameVal `json:"cookies"`
+	Headers     []HARNameVal `json:"headers"`
+	Content     HARContent   `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+	// TransferSize is the size of the whole response as received, the field of the Chrome devtools
+	TransferSize int64 `json:"_transferSize"`
+}
+
+// HARContent is the body of a response, Text is base64 encoded if Encoding is base64
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are the times in ms of the phases of a request, -1 for the phases that do not apply
+// Connect includes SSL
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARTLS are the details of the TLS connection of an entry
+type HARTLS struct {
+	Protocol     string           `json:"protocol"`
+	CipherSuite  string           `json:"cipherSuite"`
+	ServerName   string           `json:"serverName"`
+	ALPN         string           `json:"alpn,omitempty"`
+	Resumed      bool             `json:"resumed"`
+	Certificates []HARCertificate `json:"certificates"`
+}
+
+// HARCertificate is a certificate of the chain sent by the server
+type HARCertificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dnsNames,omitempty"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	Serial    string    `json:"serialNumber"`
+}
+
+// HARNameVal is a header, cookie or query parameter
+type HARNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body of a request
+type HARPostData struct {
+	MimeType string       `json:"mimeType"`
+	Text     string       `json:"text"`
+	Params   []HARNameVal `json:"params,omitempty"`
+}
+
+// skippedHeaders are the header fields not imported: the pseudo-header fields of HTTP/2 start with :,
+// the others are set by ngoperf for each connection and body, or ask for encodings ngoperf does not decode
+var skippedHeaders = map[string]bool{
+	"host": true, "content-length": true, "connection": true, "keep-alive": true,
+	"transfer-encoding": true, "upgrade": true, "te": true, "accept-encoding": true,
+}
+
+// ImportHAR returns a scenario with one step per entry of the HAR file whose url matches filter, if set
+// The times between the entries are kept as the think times of the steps
+func ImportHAR(name string, filter *regexp.Regexp) (*Scenario, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	har := &HAR{}
+	if err = json.Unmarshal(data, har); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	// the entries are not always in the order they started, e.g. when written by several tabs
+	entries := har.Log.Entries
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].StartedDateTime.Before(entries[j].StartedDateTime) })
+	sc := &Scenario{Name: strings.TrimSuffix(name, ".har")}
+	var last time.Time
+	for _, e := range entries {
+		r := e.Request
+		if filter != nil && !filter.MatchString(r.URL) {
+			continue
+		}
+		step := Step{Method: r.Method, URL: r.URL}
+		for _, h := range r.Headers {
+			step.addHeader(h.Name, h.Value)
+		}
+		if r.PostData != nil {
+			step.Body = r.PostData.Text
+			if step.Body == "" && len(r.PostData.Params) > 0 {
+				params := make([]string, len(r.PostData.Params))
+				for i, p := range r.PostData.Params {
+					params[i] = p.Name + "=" + p.Value
+				}
+				step.Body = strings.Join(params, "&")
+			}
+			if step.header("Content-Type") == "" && r.PostData.MimeType != "" && step.Body != "" {
+				step.addHeader("Content-Type", r.PostData.MimeType)
+			}
+		}
+		if !last.IsZero() && e.StartedDateTime.After(last) {
+			step.ThinkTime = e.StartedDateTime.Sub(last).Round(time.Millisecond).String()
+		}
+		last = e.StartedDateTime
+		sc.Steps = append(sc.Steps, step)
+	}
+	if len(sc.Steps) == 0 {
+		return nil, errors.New("No request to import in " + name)
+	}
+	return sc, nil
+}
+
+// addHeader adds a header field to the step, skipping the ones ngoperf sets itself
+// The values of a repeated field are joined, with ; for Cookie
+func (step *Step) addHeader(name, value string) {
+	if strings.HasPrefix(name, ":") || skippedHeaders[strings.ToLower(name)] {
+		return
+	}
+	if step.Headers == nil {
+		step.Headers = make(map[string]string)
+	}
+	// browsers write the names of HTTP/2 fields in lower case
+	for k := range step.Headers {
+		if strings.EqualFold(k, name) {
+			sep := ", "
+			if strings.EqualFold(name, "Cookie") {
+				sep = "; "
+			}
+			step.Headers[k] += sep + value
+			return
+		}
+	}
+	step.Headers[name] = value
+}
+
+// header returns the value of the header field of the step, the names are compared case-insensitively
+func (step *Step) header(name string) string {
+	for k, v := range step.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// WriteHAR writes the entries to a HAR file
+func WriteHAR(name string, entries []HAREntry) error {
+	har := HAR{Log: HARLog{Version: "1.2", Creator: HARCreator{Name: "ngoperf", Version: "1.0"}, Entries: entries}}
+	data, err := json.MarshalIndent(har, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// newHAREntry returns the entry of a response to a request sent with version, e.g. HTTP/1.1
+// bodyWritten is set if the body was written to a file and not kept
+func newHAREntry(rc *myhttp.Response, version string, bodyWritten bool) HAREntry {
+	req := rc.Request
+	body := req.Body
+	if req.BodyFile != "" {
+		body, _ = ioutil.ReadFile(req.BodyFile)
+	}
+	scheme := "http://"
+	if rc.TLS != nil {
+		scheme = "https://"
+	}
+	reqURL := req.URL
+	if !strings.Contains(reqURL, "://") {
+		reqURL = scheme + reqURL
+	}
+	// the url has the path as sent, which may differ from the one asked for, e.g. with a / appended
+	if u, err := url.Parse(reqURL); err == nil && rc.RequestPath != "" {
+		reqURL = u.Scheme + "://" + u.Host + rc.RequestPath
+	}
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+	e := HAREntry{
+		StartedDateTime: rc.StartTime(),
+		Request: HARRequest{
+			Method:      method,
+			URL:         reqURL,
+			HTTPVersion: version,
+			Cookies:     harCookies(rc.RequestHeader.Values("Cookie"), "; "),
+			Headers:     harHeaders(rc.RequestHeader),
+			QueryString: []HARNameVal{},
+			HeadersSize: -1,
+			BodySize:    int64(len(body)),
+		},
+		Response: &HARResponse{
+			Status:      rc.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(rc.Status, fmt.Sprint(rc.StatusCode))),
+			HTTPVersion: rc.Proto,
+			Cookies:     harCookies(rc.Header.Values("Set-Cookie"), ";"),
+			Headers:     harHeaders(rc.Header),
+			Content: HARContent{
+				Size:     rc.BodySize,
+				MimeType: rc.Header.Get("Content-Type"),
+			},
+			RedirectURL:  rc.Header.Get("Location"),
+			HeadersSize:  -1,
+			BodySize:     -1,
+			TransferSize: rc.ResponseSize,
+		},
+		Cache:           &struct{}{},
+		ServerIPAddress: remoteIP(rc.RemoteAddr),
+		TLS:             harTLS(rc.TLS),
+	}
+	if u, err := url.Parse(reqURL); err == nil {
+		for name, values := range u.Query() {
+			for _, v := range values {
+				e.Request.QueryString = append(e.Request.QueryString, HARNameVal{Name: name, Value: v})
+			}
+		}
+	}
+	if _, port, err := net.SplitHostPort(rc.LocalAddr); err == nil {
+		e.Connection = port
+	}
+	if len(body) > 0 {
+		e.Request.PostData = &HARPostData{MimeType: rc.RequestHeader.Get("Content-Type"), Text: string(body)}
+	}
+
+	content := &e.Response.Content
+	if content.MimeType == "" {
+		content.MimeType = "x-unknown"
+	}
+	switch {
+	case bodyWritten:
+		content.Comment = "the body was written to a file"
+	case utf8.ValidString(rc.ResponseBody):
+		content.Text = rc.ResponseBody
+	default:
+		content.Text = base64.StdEncoding.EncodeToString([]byte(rc.ResponseBody))
+		content.Encoding = "base64"
+	}
+	if rc.Truncated {
+		content.Comment = fmt.Sprintf("the body is truncated to %d bytes", len(rc.ResponseBody))
+	}
+
+	t := rc.Timings
+	ms := func(d time.Duration) float64 { return math.Round(float64(d.Microseconds())) / 1000 }
+	e.Timings = &HARTimings{Blocked: -1, DNS: -1, Connect: ms(t.Connect + t.TLS), Send: ms(t.Send), Wait: ms(t.Wait), Receive: ms(t.Receive), SSL: -1}
+	if t.DNS > 0 {
+		e.Timings.DNS = ms(t.DNS)
+	}
+	if rc.TLS != nil {
+		e.Timings.SSL = ms(t.TLS)
+	}
+	for _, v := range []float64{e.Timings.DNS, e.Timings.Connect, e.Timings.Send, e.Timings.Wait, e.Timings.Receive} {
+		if v > 0 {
+			e.Time += v
+		}
+	}
+	e.Time = math.Round(e.Time*1000) / 1000
+	return e
+}
+
+func harHeaders(h myhttp.Header) []HARNameVal {
+	headers := make([]HARNameVal, len(h))
+	for i, f := range h {
+		headers[i] = HARNameVal{Name: f.Name, Value: f.Value}
+	}
+	return headers
+}
+
+// harCookies returns the name=value pairs of Cookie values split by "; ",
+// or of the first pair of Set-Cookie values, split by ";"
+func harCookies(values []string, sep string) []HARNameVal {
+	cookies := []HARNameVal{}
+	for _, v := range values {
+		pairs := strings.Split(v, sep)
+		if sep == ";" {
+			pairs = pairs[:1]
+		}
+		for _, pair := range pairs {
+			if eq := strings.IndexByte(pair, '='); eq > 0 {
+				cookies = append(cookies, HARNameVal{Name: strings.TrimSpace(pair[:eq]), Value: strings.TrimSpace(pair[eq+1:])})
+			}
+		}
+	}
+	return cookies
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+func harTLS(state *tls.ConnectionState) *HARTLS {
+	if state == nil {
+		return nil
+	}
+	t := &HARTLS{
+		Protocol:     tlsVersions[state.Version],
+		CipherSuite:  tls.CipherSuiteName(state.CipherSuite),
+		ServerName:   state.ServerName,
+		ALPN:         state.NegotiatedProtocol,
+		Resumed:      state.DidResume,
+		Certificates: []HARCertificate{},
+	}
+	for _, cert := range state.PeerCertificates {
+		t.Certificates = append(t.Certificates, HARCertificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			Serial:    cert.SerialNumber.String(),
+		})
+	}
+	return t
+}
@@ -0,0 +1,45 @@
+package profile
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const testHAR = `{"log": {"version": "1.2", "creator": {"name": "test", "version": "1"}, "entries": [
+  {"startedDateTime": "2024-01-02T10:00:01.500Z", "time": 10,
+   "request": {"method": "POST", "url": "https://example.com/login", "httpVersion": "HTTP/2",
+     "headers": [{"name": ":authority", "value": "example.com"}, {"name": "cookie", "value": "a=1"},
+       {"name": "Cookie", "value": "b=2"}, {"name": "accept-encoding", "value": "gzip"}],
+     "postData": {"mimeType": "application/x-www-form-urlencoded", "params": [{"name": "u", "value": "me"}, {"name": "p", "value": "pw"}]}}},
+  {"startedDateTime": "2024-01-02T10:00:00Z", "time": 10,
+   "request": {"method": "GET", "url": "https://example.com/", "httpVersion": "HTTP/1.1",
+     "headers": [{"name": "Accept", "value": "text/html"}, {"name": "Host", "value": "example.com"}]}},
+  {"startedDateTime": "2024-01-02T10:00:02Z", "time": 10,
+   "request": {"method": "GET", "url": "https://cdn.example.net/app.js", "httpVersion": "HTTP/1.1", "headers": []}}
+]}}`
+
+func TestImportHAR(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "site.har")
+	if err := ioutil.WriteFile(name, []byte(testHAR), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := ImportHAR(name, regexp.MustCompile(`^https://example\.com/`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Step{
+		{Method: "GET", URL: "https://example.com/", Headers: map[string]string{"Accept": "text/html"}},
+		{Method: "POST", URL: "https://example.com/login", ThinkTime: "1.5s", Body: "u=me&p=pw",
+			Headers: map[string]string{"cookie": "a=1; b=2", "Content-Type": "application/x-www-form-urlencoded"}},
+	}
+	if !reflect.DeepEqual(sc.Steps, want) {
+		t.Errorf("ImportHAR steps = %+v, want %+v", sc.Steps, want)
+	}
+
+	if _, err = ImportHAR(name, regexp.MustCompile(`^http://`)); err == nil {
+		t.Error("ImportHAR with no matching entry succeeded")
+	}
+}
@@ -3,6 +3,7 @@ package profile
 import (
 	"encoding/csv"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ngoperf/pkg/myhttp"
@@ -28,85 +30,382 @@ type profileResult struct {
 	status       map[string]int
 	statusCode   map[int]int
 	responseBody string
+	// the response of the getter
+	response *myhttp.Response
+	// ttfb of pipelined responses by position, 1-based
+	positionTTFB map[int][]int64
+	desync       map[int]int
+	proxyTime    []int64
+	remoteAddr   map[string]int
+	byRemoteIP   map[string]*groupResult
+	byFamily     map[string]*groupResult
+	byLocalIP    map[string]*groupResult
+	// time waited for 100 Continue and how the waits ended
+	continueTime    []int64
+	continueOutcome map[string]int
+	// the records by status code when revalidating, in which case 304 counts as a success
+	byRevalidation map[string]*groupResult
+	revalidate     bool
+	// how the responses answered the range requests
+	rangeOutcome map[string]int
+	// the details of the range mismatches, when verbose
+	rangeErrors map[string]int
+	// protocol violations by rule in strict mode
+	warnings map[string]int
+	// time to the 1xx responses by status
+	interimTime map[string][]int64
+	// TCP_INFO metrics, rtt in microseconds
+	rtt         []int64
+	rttVar      []int64
+	retransmits []int64
+	cwnd        []int64
+}
+
+// Options are the settings of a profile run
+type Options struct {
+	NumRequest int
+	NumWorker  int
+	// SleepTime is the sleep time in seconds between the requests of a worker
+	SleepTime int
+	// Pipeline is the number of requests each worker writes on one connection before reading the responses
+	Pipeline int
+	// SpreadIPs is "rr" or "random" to spread the requests over all the addresses of the host
+	// The host is resolved once, or before each request if SpreadPerRequest is set
+	SpreadIPs        string
+	SpreadPerRequest bool
+	// Method is the request method, GET if empty
+	Method string
+	// Header and Body are sent with each request
+	Header myhttp.Header
+	Body   []byte
+	// BodyFile, if set, is streamed as the body instead of Body, see myhttp.Request.BodyFile
+	BodyFile string
+	// Ranges, if set, are requested and the 206 responses checked against them
+	Ranges []myhttp.ByteRange
+	// HAR, if set, is the HAR file the getter writes the request and the response to
+	HAR string
+	// Save, if set, is the file the profile run and all its records are saved to, see LoadRun
+	Save string
+	// SharedCookies shares the cookie jar of the client between the workers,
+	// otherwise each worker starts from a copy of it and the copies are merged back at the end
+	SharedCookies bool
+	// Feed, if set, fills the {{column}} placeholders of the url, header and body of each request with one of its rows
+	Feed *Feed `json:"-"`
+	// Revalidate sends one full request first and then sends If-None-Match and If-Modified-Since
+	// with its ETag and Last-Modified on all the requests
+	Revalidate bool
+	// CompareFamilies alternates the requests of each worker over IPv4 and IPv6
+	CompareFamilies bool
+	// BindIPs are the source addresses to rotate over, per worker or per request if BindPerRequest is set
+	BindIPs        []string
+	BindPerRequest bool
+	// Verbose prints the details of the range mismatches, which are only counted by kind otherwise
+	Verbose bool
 }
 
 // Profiler is used to get of profile a url depending on its setting
 type Profiler struct {
-	numRequest int
-	numWorker  int
-	http10     bool
-	verbose    bool
-	isGetter   bool
-	sleepTime  int
+	Options
+	client   myhttp.Client
+	isGetter bool
 }
 
 // NewProfiler returns a new Profiler
-// Profiler request numRequest times with numWorker and prints profile summary
-func NewProfiler(numProfile int, numWorker int, verbose, http10 bool, sleepTime int) (p *Profiler) {
+// Profiler request opts.NumRequest times with opts.NumWorker and prints profile summary
+// Each worker requests with its own copy of client
+func NewProfiler(client myhttp.Client, opts Options) (p *Profiler) {
+	// the bodies are never printed, so they are only counted
+	client.Body = ioutil.Discard
 	p = &Profiler{
-		numRequest: numProfile,
-		numWorker:  numWorker,
-		http10:     http10,
-		verbose:    verbose,
-		isGetter:   false,
-		sleepTime:  sleepTime,
+		Options:  opts,
+		client:   client,
+		isGetter: false,
 	}
 	return p
 }
 
 // NewGetter returns a new Profiler with the Getter setting
-// Getter prints response body (and response header if verbose is set)
-func NewGetter(http10 bool, verbose bool) (p *Profiler) {
+// Getter prints response body (and response header if client.Verbose is set)
+// unless client.Body is set to write the body somewhere else
+// Only the request options of opts are used
+func NewGetter(client myhttp.Client, opts Options) (p *Profiler) {
+	// the HAR has the DNS time apart from the connect time
+	client.SplitDNS = opts.HAR != ""
 	p = &Profiler{
-		numRequest: 1,
-		numWorker:  1,
-		http10:     http10,
-		verbose:    verbose,
-		isGetter:   true,
+		Options:  Options{NumRequest: 1, NumWorker: 1, Method: opts.Method, Header: opts.Header, Body: opts.Body, BodyFile: opts.BodyFile, Ranges: opts.Ranges, HAR: opts.HAR},
+		client:   client,
+		isGetter: true,
 	}
 	return p
 }
 
 // RunProfile profiles the url
 func (p *Profiler) RunProfile(reqURL string) {
-	result := &profileResult{
-		status:     make(map[string]int),
-		fatalError: make(map[string]int),
-		statusCode: make(map[int]int),
+	p.RunTargets([]Target{{URL: reqURL, Weight: 1}})
+}
+
+func newProfileResult() *profileResult {
+	return &profileResult{
+		status:          make(map[string]int),
+		fatalError:      make(map[string]int),
+		statusCode:      make(map[int]int),
+		positionTTFB:    make(map[int][]int64),
+		desync:          make(map[int]int),
+		remoteAddr:      make(map[string]int),
+		byRemoteIP:      make(map[string]*groupResult),
+		byFamily:        make(map[string]*groupResult),
+		byLocalIP:       make(map[string]*groupResult),
+		interimTime:     make(map[string][]int64),
+		warnings:        make(map[string]int),
+		continueOutcome: make(map[string]int),
+		rangeOutcome:    make(map[string]int),
+		rangeErrors:     make(map[string]int),
+		byRevalidation:  make(map[string]*groupResult),
+	}
+}
+
+// job is a number of requests to send to a target on one connection
+type job struct {
+	target int
+	n      int
+}
+
+// record is a response with the index of the target it answers
+type record struct {
+	target int
+	*myhttp.Response
+}
+
+// RunTargets profiles the targets, the requests are spread over them by weight
+// With more than one target, the results of each target are printed before the total
+func (p *Profiler) RunTargets(targets []Target) {
+	if p.Feed != nil {
+		if p.Pipeline > 1 || p.Revalidate {
+			fmt.Println("--data-feed cannot be used with --pipeline or --revalidate")
+			return
+		}
+		if err := p.Feed.Check(p.NumRequest); err != nil {
+			fmt.Println(err)
+			return
+		}
+		// the body is filled for each request, so it is read in memory
+		if p.BodyFile != "" {
+			body, err := ioutil.ReadFile(p.BodyFile)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			p.Body, p.BodyFile = body, ""
+		}
+	}
+	requests := make([]*myhttp.Request, len(targets))
+	var primed []record
+	for i, t := range targets {
+		method := t.Method
+		if method == "" {
+			method = p.Method
+		}
+		requests[i] = &myhttp.Request{Method: method, URL: t.URL, Header: p.Header, Body: p.Body, BodyFile: p.BodyFile, Ranges: p.Ranges, SlashPath: !t.ExactPath}
+		if len(t.Header) > 0 {
+			// the header fields of the target replace the ones of the options
+			header := myhttp.Header{}
+			for _, f := range p.Header {
+				if len(t.Header.Values(f.Name)) == 0 {
+					header.Add(f.Name, f.Value)
+				}
+			}
+			requests[i].Header = append(header, t.Header...)
+		}
+		if t.Body != nil {
+			requests[i].Body, requests[i].BodyFile = t.Body, ""
+		}
+		if p.Revalidate {
+			header, rc, err := p.prime(requests[i])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			requests[i].Header = header
+			primed = append(primed, record{target: i, Response: rc})
+		}
 	}
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	records := make(chan *myhttp.Response, p.numRequest)
-	jobs := make(chan int, p.numRequest)
+	start := time.Now()
+	records := make(chan record, p.NumRequest)
+	jobs := make(chan job, p.NumRequest)
 	var bar *pb.ProgressBar
 	if !p.isGetter {
-		bar = pb.StartNew(p.numRequest)
+		bar = pb.StartNew(p.NumRequest)
+	}
+
+	var spreader *ipSpreader
+	if p.SpreadIPs != "" {
+		for _, t := range targets[1:] {
+			if targetHost(t.URL) != targetHost(targets[0].URL) {
+				fmt.Println("--spread-ips needs the urls to share one host")
+				return
+			}
+		}
+		var err error
+		spreader, err = newIPSpreader(&p.client, targets[0].URL, p.SpreadIPs, p.SpreadPerRequest)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 	}
 
+	var seq, bindSeq uint64
+	var jars []*myhttp.CookieJar
 	var wg sync.WaitGroup
-	for i := 0; i < p.numWorker; i++ {
+	for i := 0; i < p.NumWorker; i++ {
 		wg.Add(1)
-		cfg := &workerCFG{http10: p.http10, verbose: p.verbose, bar: bar, sleepTime: p.sleepTime}
-		go worker(&wg, jobs, records, reqURL, cfg)
+		cfg := &workerCFG{client: p.client, bar: bar, sleepTime: p.SleepTime, spreader: spreader, feed: p.Feed, compareFamilies: p.CompareFamilies, seq: &seq, pipelined: p.Pipeline > 1}
+		if len(p.BindIPs) > 0 {
+			if p.BindPerRequest {
+				cfg.bindIPs = p.BindIPs
+				cfg.bindSeq = &bindSeq
+			} else {
+				cfg.client.LocalIP = p.BindIPs[i%len(p.BindIPs)]
+			}
+		}
+		if p.client.Jar != nil && !p.SharedCookies {
+			cfg.client.Jar = p.client.Jar.Clone()
+			jars = append(jars, cfg.client.Jar)
+		}
+		go worker(&wg, jobs, records, requests, cfg)
 	}
 
+	// each job is the number of requests to send on one connection
+	batch := 1
+	if p.Pipeline > 1 {
+		batch = p.Pipeline
+	}
+	// the target is picked per request so the counts follow the weights with any batch,
+	// the requests of a target are sent once a batch of them is picked, the rest at the end
+	picker := newTargetPicker(targets)
 	go func() {
-		for i := 0; i < p.numRequest; i++ {
-			jobs <- i
+		pending := make([]int, len(targets))
+		for i := 0; i < p.NumRequest; i++ {
+			t := picker.next()
+			pending[t]++
+			if pending[t] == batch {
+				jobs <- job{target: t, n: batch}
+				pending[t] = 0
+			}
+		}
+		for t, n := range pending {
+			if n > 0 {
+				jobs <- job{target: t, n: n}
+			}
 		}
 		close(jobs)
 	}()
 	wg.Wait()
 	close(records)
+	for _, jar := range jars {
+		p.client.Jar.Merge(jar)
+	}
 
 	if bar != nil {
 		bar.Finish()
 	}
-	aggregateResult(p, records, result)
-	if p.isGetter {
+	// the full responses of the revalidation are the baseline of the 304 responses
+	recs := primed
+	for rec := range records {
+		recs = append(recs, rec)
+	}
+	elapsed := time.Since(start)
+	if !p.isGetter {
+		p.report(targets, recs)
+		if p.Save != "" {
+			if err := p.saveRun(targets, start, elapsed, recs); err != nil {
+				fmt.Println("Could not save the run:", err)
+			}
+		}
+		return
+	}
+
+	result := newProfileResult()
+	for _, rec := range recs {
+		result.add(p, rec.Response)
+	}
+	if p.client.Body == nil {
 		fmt.Println(result.responseBody)
-	} else {
-		printProfileResults(result, reqURL)
+	}
+	if rc := result.response; rc != nil && rc.Truncated {
+		fmt.Printf("The body is truncated to %s of %s bytes\n", prettyInt64(p.client.MaxBody), prettyInt64(rc.BodySize))
+	}
+	if rc := result.response; rc != nil && len(p.Ranges) > 0 {
+		printRanges(rc)
+	}
+	if rc := result.response; rc != nil && len(rc.Warnings) > 0 {
+		fmt.Println("\nProtocol Violations:")
+		for _, w := range rc.Warnings {
+			fmt.Println(w.String())
+		}
+	}
+	if rc := result.response; rc != nil && p.HAR != "" {
+		version := "HTTP/1.1"
+		if p.client.HTTP10 {
+			version = "HTTP/1.0"
+		}
+		if err := WriteHAR(p.HAR, []HAREntry{newHAREntry(rc, version, p.client.Body != nil)}); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if len(result.fatalError) > 0 {
+		printErrors(result)
+	}
+}
+
+// report prints the results of the records of a profile run, by target if there are more than one and in total
+func (p *Profiler) report(targets []Target, recs []record) {
+	result := newProfileResult()
+	var byTarget []*profileResult
+	byURL := make(map[string]*groupResult)
+	if len(targets) > 1 {
+		byTarget = make([]*profileResult, len(targets))
+		for i := range byTarget {
+			byTarget[i] = newProfileResult()
+		}
+	}
+	for _, rec := range recs {
+		result.add(p, rec.Response)
+		if byTarget != nil {
+			byTarget[rec.target].add(p, rec.Response)
+			addGroupRecord(byURL, targets[rec.target].String(), rec.Response)
+		}
+	}
+	for i, t := range targets {
+		if byTarget == nil {
+			break
+		}
+		fmt.Printf("\n=== %s (weight %d) ===\n", t.String(), t.Weight)
+		printProfileResults(byTarget[i], t.URL)
+		if len(byTarget[i].fatalError) > 0 {
+			printErrors(byTarget[i])
+		}
+	}
+	label := targets[0].URL
+	if byTarget != nil {
+		fmt.Println("\n=== Total ===")
+		printGroupSummary("\nThe Summary by URL (TTFB in ms):", "url", byURL)
+		label = "total"
+	}
+	printProfileResults(result, label)
+	if p.SpreadIPs != "" {
+		printGroupSummary("\nThe Summary by Remote IP (TTFB in ms):", "remote ip", result.byRemoteIP)
+	}
+	if len(p.BindIPs) > 0 {
+		printGroupSummary("\nThe Summary by Source IP (TTFB in ms):", "source ip", result.byLocalIP)
+	}
+	if p.Revalidate {
+		printRevalidationSummary(result.byRevalidation)
+	}
+	if p.CompareFamilies {
+		printGroupSummary("\nThe Summary by Address Family (TTFB in ms):", "family", result.byFamily)
+		printPercentileComparison("\nThe Percentiles of Time to First Byte by Address Family (ms):", result.byFamily)
 	}
 	if len(result.fatalError) > 0 {
 		printErrors(result)
@@ -114,34 +413,73 @@ func (p *Profiler) RunProfile(reqURL string) {
 }
 
 type workerCFG struct {
-	http10  bool
-	verbose bool
+	client myhttp.Client
 	// bar.Increment is atomic
 	bar       *pb.ProgressBar
 	sleepTime int
+	spreader  *ipSpreader
+	feed      *Feed
+	// alternate the requests over tcp4 and tcp6, seq counts the requests of all workers
+	compareFamilies bool
+	seq             *uint64
+	// rotate the requests over bindIPs, bindSeq counts the requests of all workers
+	bindIPs []string
+	bindSeq *uint64
+	// send all the jobs with Pipeline, even the ones of one request, so they all have a Position
+	pipelined bool
 }
 
-func worker(wg *sync.WaitGroup, jobs chan int, records chan *myhttp.Response, reqURL string, cfg *workerCFG) {
+func worker(wg *sync.WaitGroup, jobs chan job, records chan record, requests []*myhttp.Request, cfg *workerCFG) {
 	defer wg.Done()
 	var r *rand.Rand
 	if cfg.sleepTime > 0 {
 		r = rand.New(rand.NewSource(time.Now().Unix()))
 	}
 
-	client := &myhttp.Client{Verbose: cfg.verbose, HTTP10: cfg.http10}
-	for range jobs {
-		rc, err := client.GET(reqURL)
-		if err != nil {
-			if cfg.verbose {
-				errStr := fmt.Sprintf("GET rerror %s: %s", reqURL, err.Error())
-				fmt.Println(errStr)
+	client := cfg.client
+	for j := range jobs {
+		req, n := requests[j.target], j.n
+		if cfg.compareFamilies {
+			client.Network = "tcp4"
+			if atomic.AddUint64(cfg.seq, 1)%2 == 0 {
+				client.Network = "tcp6"
+			}
+		}
+		if len(cfg.bindIPs) > 0 {
+			client.LocalIP = cfg.bindIPs[atomic.AddUint64(cfg.bindSeq, 1)%uint64(len(cfg.bindIPs))]
+		}
+		if cfg.spreader != nil {
+			client.IP = cfg.spreader.next(&client)
+		}
+		var row map[string]string
+		if cfg.feed != nil {
+			var ok bool
+			if row, ok = cfg.feed.Next(); ok {
+				req = fill(req, row)
+			}
+		}
+		var rcs []*myhttp.Response
+		if cfg.pipelined {
+			rcs = pipeline(&client, req, n)
+		} else if cfg.feed != nil && row == nil {
+			rcs = []*myhttp.Response{{Request: req, Status: "data feed exhausted"}}
+		} else {
+			rc, err := client.Do(req)
+			if err != nil {
+				if client.Verbose {
+					errStr := fmt.Sprintf("%s rerror %s: %s", req.Method, req.URL, err.Error())
+					fmt.Println(errStr)
+				}
+				rc = &myhttp.Response{Request: req, Status: err.Error(), RemoteAddr: client.IP, Network: client.Network, LocalAddr: client.LocalIP}
 			}
-			rc = &myhttp.Response{Status: err.Error()}
+			rcs = []*myhttp.Response{rc}
 		}
-		if cfg.bar != nil {
-			cfg.bar.Increment()
+		for _, rc := range rcs {
+			if cfg.bar != nil {
+				cfg.bar.Increment()
+			}
+			records <- record{target: j.target, Response: rc}
 		}
-		records <- rc
 		if r != nil {
 			time.Sleep(time.Millisecond * time.Duration(cfg.sleepTime*1000))
 		}
@@ -151,25 +489,130 @@ func worker(wg *sync.WaitGroup, jobs chan int, records chan *myhttp.Response, re
 	}
 }
 
-func aggregateResult(p *Profiler, records chan *myhttp.Response, result *profileResult) {
-	for rec := range records {
-		if rec.StatusCode == 0 {
-			errorLen := len(rec.Status)
-			if errorLen > 20 {
-				errorLen = 20
-			}
-			result.fatalError[rec.Status[:errorLen]]++
-			continue
+// desyncStatus is the status of pipelined responses lost to a framing error
+const desyncStatus = "framing desync"
+
+// pipeline sends n pipelined requests and always returns n records,
+// the responses lost to an error are recorded with the error as status
+func pipeline(client *myhttp.Client, req *myhttp.Request, n int) []*myhttp.Response {
+	rcs, err := client.Pipeline(req, n)
+	if err == nil {
+		return rcs
+	}
+	if client.Verbose {
+		fmt.Println(fmt.Sprintf("Pipeline error %s: %s", req.URL, err.Error()))
+	}
+	status := err.Error()
+	if _, ok := err.(*myhttp.DesyncError); ok {
+		status = desyncStatus
+	}
+	for i := len(rcs) + 1; i <= n; i++ {
+		rcs = append(rcs, &myhttp.Response{Request: req, Status: status, Position: i, RemoteAddr: client.IP, Network: client.Network, LocalAddr: client.LocalIP})
+	}
+	return rcs
+}
+
+// add aggregates one record into the result
+func (result *profileResult) add(p *Profiler, rec *myhttp.Response) {
+	if p.SpreadIPs != "" {
+		addGroupRecord(result.byRemoteIP, remoteIP(rec.RemoteAddr), rec)
+	}
+	if len(p.BindIPs) > 0 {
+		addGroupRecord(result.byLocalIP, remoteIP(rec.LocalAddr), rec)
+	}
+	if p.CompareFamilies {
+		addGroupRecord(result.byFamily, family(rec), rec)
+	}
+	if p.Revalidate {
+		result.revalidate = true
+		addGroupRecord(result.byRevalidation, revalidationKey(rec), rec)
+	}
+	if rec.StatusCode == 0 && rec.Status == desyncStatus {
+		result.desync[rec.Position]++
+	}
+	if rec.StatusCode == 0 {
+		errorLen := len(rec.Status)
+		if errorLen > 20 {
+			errorLen = 20
 		}
-		result.status[rec.Status]++
-		if p.isGetter {
-			result.responseBody = rec.ResponseBody
-			continue
+		result.fatalError[rec.Status[:errorLen]]++
+		return
+	}
+	result.status[rec.Status]++
+	if p.isGetter {
+		result.responseBody = rec.ResponseBody
+		result.response = rec
+		return
+	}
+	result.ttfb = append(result.ttfb, rec.TTFB)
+	result.responseSize = append(result.responseSize, rec.ResponseSize)
+	result.statusCode[rec.StatusCode]++
+	if rec.RemoteAddr != "" {
+		result.remoteAddr[rec.RemoteAddr]++
+	}
+	for _, w := range rec.Warnings {
+		result.warnings[w.Rule]++
+	}
+	for _, interim := range rec.Interim {
+		result.interimTime[interim.Status] = append(result.interimTime[interim.Status], interim.Time)
+	}
+	if rec.TCPInfo != nil {
+		result.rtt = append(result.rtt, int64(rec.TCPInfo.RTT))
+		result.rttVar = append(result.rttVar, int64(rec.TCPInfo.RTTVar))
+		result.retransmits = append(result.retransmits, int64(rec.TCPInfo.Retransmits))
+		result.cwnd = append(result.cwnd, int64(rec.TCPInfo.Cwnd))
+	}
+	if p.client.ExpectContinue && hasBody(rec.Request) && !p.client.HTTP10 && rec.Position == 0 {
+		result.continueTime = append(result.continueTime, rec.ContinueTime)
+		result.continueOutcome[continueOutcome(rec.ContinueStatus)]++
+	}
+	if len(p.Ranges) > 0 {
+		result.rangeOutcome[rangeOutcome(rec)]++
+		if p.Verbose && rec.RangeError != "" {
+			result.rangeErrors[rec.RangeError]++
 		}
-		result.ttfb = append(result.ttfb, rec.TTFB)
-		result.responseSize = append(result.responseSize, rec.ResponseSize)
-		result.statusCode[rec.StatusCode]++
 	}
+	if rec.Proxy != "" {
+		result.proxyTime = append(result.proxyTime, rec.ProxyTime)
+	}
+	if rec.Position > 0 {
+		result.positionTTFB[rec.Position] = append(result.positionTTFB[rec.Position], rec.TTFB)
+	}
+}
+
+// continueOutcome names how the wait for 100 Continue ended
+func continueOutcome(statusCode int) string {
+	switch statusCode {
+	case 0:
+		return "timeout, body sent"
+	case 100:
+		return "100 Continue, body sent"
+	default:
+		return fmt.Sprintf("%d before the body, body not sent", statusCode)
+	}
+}
+
+// rangeOutcome names how the response answered the range request
+func rangeOutcome(rec *myhttp.Response) string {
+	switch {
+	case rec.StatusCode == 206 && rec.RangeMismatch != "":
+		return "206 mismatch: " + rec.RangeMismatch
+	case rec.StatusCode == 206 && len(rec.Parts) == 1:
+		return "206 match, 1 part"
+	case rec.StatusCode == 206:
+		return fmt.Sprintf("206 match, %d parts", len(rec.Parts))
+	case rec.StatusCode == 200:
+		return "200 range ignored"
+	case rec.StatusCode == 416:
+		return "416 range not satisfiable"
+	default:
+		return rec.Status
+	}
+}
+
+// hasBody reports whether the request is sent with a body, of its own or of the options
+func hasBody(req *myhttp.Request) bool {
+	return req != nil && (len(req.Body) > 0 || req.BodyFile != "")
 }
 
 func printProfileResults(result *profileResult, url string) {
@@ -179,10 +622,38 @@ func printProfileResults(result *profileResult, url string) {
 		return
 	}
 	fmt.Println()
-	printSuccessRate(n, &result.statusCode)
-	printStatusSummary(result.status)
+	printSuccessRate(n, &result.statusCode, result.revalidate)
+	printStatusSummary(result.status, result.revalidate)
 	printTTFBSummary(result.ttfb)
+	if len(result.proxyTime) > 0 {
+		printIntervalSummary("\nThe Summary of Proxy Tunnel Time (ms):", result.proxyTime)
+	}
+	if len(result.continueTime) > 0 {
+		printIntervalSummary("\nThe Summary of 100 Continue Wait Time (ms):", result.continueTime)
+		printCountSummary("\nThe Ends of the 100 Continue Waits:", "end", result.continueOutcome)
+	}
 	printSizeSummary(result.responseSize)
+	if len(result.rangeOutcome) > 0 {
+		printCountSummary("\nThe Range Responses:", "response", result.rangeOutcome)
+	}
+	if len(result.rangeErrors) > 0 {
+		printCountSummary("\nThe Range Mismatches:", "mismatch", result.rangeErrors)
+	}
+	if len(result.interimTime) > 0 {
+		printInterimSummary(result.interimTime)
+	}
+	if len(result.warnings) > 0 {
+		printCountSummary("\nThe Protocol Violations:", "rule", result.warnings)
+	}
+	if len(result.rtt) > 0 {
+		printTCPInfoSummary(result)
+	}
+	if len(result.byRemoteIP) == 0 {
+		printCountSummary("\nThe Remote Addresses:", "address", result.remoteAddr)
+	}
+	if len(result.positionTTFB) > 0 || len(result.desync) > 0 {
+		printPipelineSummary(result)
+	}
 
 	// for draw figure
 	// writeCSV(result.ttfb, result.responseSize, url)
@@ -210,11 +681,11 @@ func writeCSV(ttfb []int64, size []int64, url string) {
 	}
 }
 
-func printSuccessRate(n int, statusCode *map[int]int) {
+func printSuccessRate(n int, statusCode *map[int]int, notModified bool) {
 	success := 0
 	for st, cnt := range *statusCode {
 
-		if st/100 == 2 {
+		if st/100 == 2 || notModified && st == 304 {
 			success += cnt
 		}
 	}
@@ -222,13 +693,13 @@ func printSuccessRate(n int, statusCode *map[int]int) {
 	fmt.Println(fmt.Sprintf("The success rate is: %.1f %%", float32(success)*100/float32(n)))
 }
 
-func printStatusSummary(status map[string]int) {
+func printStatusSummary(status map[string]int, notModified bool) {
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"status", "count"})
 	summary := [][]string{}
 	for st, cnt := range status {
 		data := []string{st, prettyInt(cnt)}
-		if !strings.HasPrefix(st, "2") {
+		if !strings.HasPrefix(st, "2") && !(notModified && strings.HasPrefix(st, "304")) {
 			table.Rich(data, []tablewriter.Colors{{tablewriter.BgRedColor}})
 		} else {
 			table.Rich(data, []tablewriter.Colors{{tablewriter.BgGreenColor}})
@@ -243,7 +714,11 @@ func printStatusSummary(status map[string]int) {
 }
 
 func printTTFBSummary(intervals []int64) {
-	fmt.Println("\nThe Summary of Time to First Byte (ms):")
+	printIntervalSummary("\nThe Summary of Time to First Byte (ms):", intervals)
+}
+
+func printIntervalSummary(title string, intervals []int64) {
+	fmt.Println(title)
 	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
 	n := len(intervals)
 	var sum int64 = 0
@@ -289,6 +764,93 @@ func printSizeSummary(responseSize []int64) {
 	table.Render()
 }
 
+func printInterimSummary(interimTime map[string][]int64) {
+	fmt.Println("\nThe Summary of Time to Interim Responses (ms):")
+	statuses := []string{}
+	for st := range interimTime {
+		statuses = append(statuses, st)
+	}
+	sort.Strings(statuses)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"status", "count", "fast", "slow", "mean", "median"})
+	for _, st := range statuses {
+		data := []string{st, prettyInt(len(interimTime[st]))}
+		table.Append(append(data, intervalStats(interimTime[st])...))
+	}
+	table.Render()
+}
+
+func printTCPInfoSummary(result *profileResult) {
+	fmt.Println("\nThe Summary of TCP_INFO:")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"metric", "min", "max", "mean", "median", "p90"})
+	metrics := []struct {
+		name   string
+		values []int64
+	}{
+		{"rtt (us)", result.rtt},
+		{"rtt var (us)", result.rttVar},
+		{"retransmits", result.retransmits},
+		{"cwnd (segments)", result.cwnd},
+	}
+	for _, m := range metrics {
+		data := append([]string{m.name}, intervalStats(m.values)...)
+		data = append(data, prettyInt64(percentile(m.values, 90)))
+		table.Append(data)
+	}
+	table.Render()
+}
+
+func printPipelineSummary(result *profileResult) {
+	fmt.Println("\nThe Summary of Time to First Byte by Pipeline Position (ms):")
+	positions := []int{}
+	for pos := range result.positionTTFB {
+		positions = append(positions, pos)
+	}
+	for pos := range result.desync {
+		if _, ok := result.positionTTFB[pos]; !ok {
+			positions = append(positions, pos)
+		}
+	}
+	sort.Ints(positions)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"position", "responses", "desync", "fast", "slow", "mean", "median"})
+	for _, pos := range positions {
+		intervals := result.positionTTFB[pos]
+		data := []string{strconv.Itoa(pos), prettyInt(len(intervals)), prettyInt(result.desync[pos])}
+		data = append(data, intervalStats(intervals)...)
+		if result.desync[pos] > 0 {
+			table.Rich(data, []tablewriter.Colors{{}, {}, {tablewriter.BgRedColor}})
+		} else {
+			table.Append(data)
+		}
+	}
+	table.Render()
+}
+
+func printCountSummary(title string, key string, counts map[string]int) {
+	fmt.Println(title)
+	keys := []string{}
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{key, "count"})
+	table.SetAutoWrapText(false)
+	for _, k := range keys {
+		table.Append([]string{k, prettyInt(counts[k])})
+	}
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold},
+		tablewriter.Colors{tablewriter.Bold},
+	)
+	table.Render()
+}
+
 var printer = message.NewPrinter(language.English)
 
 func prettyInt64(val int64) string {
@@ -299,7 +861,20 @@ func prettyInt(val int) string {
 	return printer.Sprintf("%d", val)
 }
 
+func printRanges(rc *myhttp.Response) {
+	fmt.Println("\nRange: " + rangeOutcome(rc))
+	if rc.RangeError != "" {
+		fmt.Println("  " + rc.RangeError)
+	}
+	for _, part := range rc.Parts {
+		fmt.Println("  " + part.String())
+	}
+	if cr := rc.Header.Get("Content-Range"); rc.StatusCode == 416 && cr != "" {
+		fmt.Println("  Content-Range: " + cr)
+	}
+}
+
 func printErrors(result *profileResult) {
 	fmt.Println("\nFatal Errors:")
-	printStatusSummary(result.fatalError)
+	printStatusSummary(result.fatalError, false)
 }
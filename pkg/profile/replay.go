@@ -0,0 +1,294 @@
+package profile
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ngoperf/pkg/myhttp"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// LogEntry is one request of an access log
+type LogEntry struct {
+	Time   time.Time
+	Method string
+	// Path is the path and query of the request
+	Path      string
+	UserAgent string
+	Referer   string
+	// Status is the status code the request got when it was logged, 0 if unknown
+	Status int
+}
+
+// The fields of a JSON log entry, see LogFields
+var logFieldNames = []string{"time", "method", "path", "request", "status", "user_agent", "referer"}
+
+// LogFields maps the fields of LogEntry to the keys of JSON log lines, dot paths like req.method can be used
+// The request field is a whole "GET /path HTTP/1.1" request line, used if method or path is not found
+type LogFields map[string]string
+
+// DefaultLogFields are the keys of the JSON log lines if not set
+var DefaultLogFields = LogFields{
+	"time":       "time",
+	"method":     "method",
+	"path":       "path",
+	"request":    "request",
+	"status":     "status",
+	"user_agent": "user_agent",
+	"referer":    "referer",
+}
+
+// ParseLogFields parses "field=key,field=key" into the DefaultLogFields with the keys replaced
+func ParseLogFields(s string) (LogFields, error) {
+	fields := LogFields{}
+	for k, v := range DefaultLogFields {
+		fields[k] = v
+	}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		name := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || strings.TrimSpace(kv[1]) == "" {
+			return nil, errors.New("Invalid log field, want field=key: " + pair)
+		}
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("Invalid log field %s, want one of %s", name, strings.Join(logFieldNames, ", "))
+		}
+		fields[name] = strings.TrimSpace(kv[1])
+	}
+	return fields, nil
+}
+
+// combinedLog matches the nginx and Apache combined log format, the referer and user agent are optional
+// so the common log format matches too
+var combinedLog = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}|-) \S+(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+const commonLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// LoadLog reads the requests of an access log sorted by time
+// format is combined, json, or auto to read the lines starting with { as JSON
+// It returns the number of lines skipped because they could not be parsed
+func LoadLog(name, format string, fields LogFields) ([]LogEntry, int, error) {
+	if format != "auto" && format != "combined" && format != "json" {
+		return nil, 0, errors.New("Invalid log format, want auto, combined or json: " + format)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	var entries []LogEntry
+	skipped := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var e LogEntry
+		if format == "json" || format == "auto" && strings.HasPrefix(line, "{") {
+			e, err = parseJSONLog(line, fields)
+		} else {
+			e, err = parseCombinedLog(line)
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(entries) == 0 {
+		return nil, skipped, errors.New("No request in " + name)
+	}
+	// the servers log a request when it ends, so the lines are not always in order
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, skipped, nil
+}
+
+func parseCombinedLog(line string) (LogEntry, error) {
+	m := combinedLog.FindStringSubmatch(line)
+	if m == nil {
+		return LogEntry{}, errors.New("not a combined log line")
+	}
+	t, err := time.Parse(commonLogTime, m[1])
+	if err != nil {
+		return LogEntry{}, err
+	}
+	e := LogEntry{Time: t, UserAgent: logValue(m[5]), Referer: logValue(m[4])}
+	if e.Method, e.Path, err = parseRequestLine(m[2]); err != nil {
+		return LogEntry{}, err
+	}
+	e.Status, _ = strconv.Atoi(m[3])
+	return e, nil
+}
+
+func parseJSONLog(line string, fields LogFields) (LogEntry, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &obj); err != nil {
+		return LogEntry{}, err
+	}
+	get := func(field string) string {
+		key := fields[field]
+		// flattened logs have keys with dots
+		if v, ok := obj[key]; ok {
+			if s, ok := v.(string); ok {
+				return s
+			}
+		}
+		v, err := jsonLookup(obj, key)
+		if err != nil {
+			return ""
+		}
+		return v
+	}
+	t, err := parseLogTime(get("time"))
+	if err != nil {
+		return LogEntry{}, err
+	}
+	e := LogEntry{Time: t, Method: get("method"), Path: get("path"), UserAgent: logValue(get("user_agent")), Referer: logValue(get("referer"))}
+	if e.Method == "" || e.Path == "" {
+		if e.Method, e.Path, err = parseRequestLine(get("request")); err != nil {
+			return LogEntry{}, err
+		}
+	}
+	if !strings.HasPrefix(e.Path, "/") {
+		return LogEntry{}, errors.New("invalid path " + e.Path)
+	}
+	e.Status, _ = strconv.Atoi(get("status"))
+	return e, nil
+}
+
+// parseRequestLine returns the method and path of a "GET /path HTTP/1.1" request line
+func parseRequestLine(s string) (method, path string, err error) {
+	parts := strings.Fields(s)
+	if len(parts) < 2 || !isMethod(parts[0]) || !strings.HasPrefix(parts[1], "/") {
+		return "", "", errors.New("invalid request line " + s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// parseLogTime parses RFC 3339, common log format and Unix times in seconds or milliseconds
+func parseLogTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, commonLogTime, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time " + s)
+	}
+	if sec > 1e12 {
+		sec /= 1000
+	}
+	whole, frac := math.Modf(sec)
+	return time.Unix(int64(whole), int64(frac*1e9)), nil
+}
+
+// logValue returns "" for the "-" of the empty log values
+func logValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// replayResult is the result of a replay, shared by the requests
+type replayResult struct {
+	mu  sync.Mutex
+	all *profileResult
+	// lag is how late in ms the requests were sent after their scaled log times
+	lag []int64
+	// statusChange counts the log status against the replay status of the requests
+	statusChange map[string]int
+}
+
+// RunReplay sends the requests of the log to target keeping their relative times, divided by speed
+// With speed 0 the requests are sent as fast as NumWorker allows
+// NumWorker is the max number of requests in flight, a request is sent late when all of them are busy
+func (p *Profiler) RunReplay(entries []LogEntry, target string, speed float64) {
+	target = strings.TrimSuffix(target, "/")
+	result := &replayResult{all: newProfileResult(), statusChange: make(map[string]int)}
+	bar := pb.StartNew(len(entries))
+	inFlight := make(chan struct{}, p.NumWorker)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, e := range entries {
+		due := start
+		if speed > 0 {
+			due = start.Add(time.Duration(float64(e.Time.Sub(entries[0].Time)) / speed))
+			time.Sleep(time.Until(due))
+		}
+		inFlight <- struct{}{}
+		lag := time.Since(due).Milliseconds()
+		wg.Add(1)
+		go func(e LogEntry) {
+			defer wg.Done()
+			rc := p.replay(e, target)
+			<-inFlight
+			result.mu.Lock()
+			result.all.add(p, rc)
+			result.lag = append(result.lag, lag)
+			if e.Status > 0 {
+				replayed := "error"
+				if rc.StatusCode > 0 {
+					replayed = strconv.Itoa(rc.StatusCode)
+				}
+				result.statusChange[fmt.Sprintf("%d -> %s", e.Status, replayed)]++
+			}
+			result.mu.Unlock()
+			bar.Increment()
+		}(e)
+	}
+	wg.Wait()
+	bar.Finish()
+
+	span := entries[len(entries)-1].Time.Sub(entries[0].Time)
+	fmt.Printf("\nReplayed %s requests of %s in %s\n", prettyInt(len(entries)), span, time.Since(start).Round(time.Millisecond))
+	printProfileResults(result.all, target)
+	printIntervalSummary("\nThe Summary of Replay Lag (ms):", result.lag)
+	if len(result.statusChange) > 0 {
+		printCountSummary("\nThe Status Codes, Logged -> Replayed:", "status", result.statusChange)
+	}
+	if len(result.all.fatalError) > 0 {
+		printErrors(result.all)
+	}
+}
+
+// replay sends the request of the log entry to target and returns its record
+func (p *Profiler) replay(e LogEntry, target string) *myhttp.Response {
+	client := p.client
+	req := &myhttp.Request{Method: e.Method, URL: target + e.Path, Header: append(myhttp.Header{}, p.Header...)}
+	if e.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Add("User-Agent", e.UserAgent)
+	}
+	if e.Referer != "" && req.Header.Get("Referer") == "" {
+		req.Header.Add("Referer", e.Referer)
+	}
+	rc, err := client.Do(req)
+	if client.Conn != nil {
+		client.Conn.Close()
+	}
+	if err != nil {
+		return &myhttp.Response{Request: req, Status: err.Error(), RemoteAddr: client.IP}
+	}
+	return rc
+}
@@ -0,0 +1,126 @@
+package profile
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCombinedLog(t *testing.T) {
+	tests := []struct {
+		line string
+		want LogEntry
+		ok   bool
+	}{
+		{
+			line: `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			want: LogEntry{Time: time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC), Method: "GET", Path: "/apache_pb.gif?a=1",
+				Status: 200, Referer: "http://www.example.com/start.html", UserAgent: "Mozilla/4.08 [en] (Win98; I ;Nav)"},
+			ok: true,
+		},
+		{
+			line: `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "POST /api HTTP/1.1" 201 -`,
+			want: LogEntry{Time: time.Date(2000, 10, 10, 13, 55, 36, 0, time.UTC), Method: "POST", Path: "/api", Status: 201},
+			ok:   true,
+		},
+		{
+			line: `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "GET /q?s=\"x\" HTTP/1.1" - 0 "-" "-"`,
+			want: LogEntry{Time: time.Date(2000, 10, 10, 13, 55, 36, 0, time.UTC), Method: "GET", Path: `/q?s=\"x\"`},
+			ok:   true,
+		},
+		{line: `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "-" 400 0 "-" "-"`},
+		{line: `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "\x16\x03\x01" 400 0 "-" "-"`},
+		{line: `10.0.0.1 - - [yesterday] "GET / HTTP/1.1" 200 0`},
+		{line: `not a log line`},
+	}
+	for _, tt := range tests {
+		got, err := parseCombinedLog(tt.line)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("parseCombinedLog(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil || !got.Time.Equal(tt.want.Time) {
+			t.Errorf("parseCombinedLog(%q) = %+v, %v, want %+v", tt.line, got, err, tt.want)
+			continue
+		}
+		got.Time = tt.want.Time
+		if got != tt.want {
+			t.Errorf("parseCombinedLog(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseJSONLog(t *testing.T) {
+	fields, err := ParseLogFields("time=ts, path=req.uri,status=res.status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line string
+		want LogEntry
+		ok   bool
+	}{
+		{
+			line: `{"ts": "2024-01-02T03:04:05.5Z", "method": "PUT", "req": {"uri": "/a?b=c", "status": 1}, "res": {"status": 204}}`,
+			want: LogEntry{Time: time.Date(2024, 1, 2, 3, 4, 5, 5e8, time.UTC), Method: "PUT", Path: "/a?b=c", Status: 204},
+			ok:   true,
+		},
+		{
+			line: `{"ts": "1704164645", "request": "GET /x HTTP/1.1", "user_agent": "curl/8"}`,
+			want: LogEntry{Time: time.Unix(1704164645, 0), Method: "GET", Path: "/x", UserAgent: "curl/8"},
+			ok:   true,
+		},
+		{line: `{"ts": "1704164645", "method": "GET", "req": {"uri": "x"}}`},
+		{line: `{"ts": "soon", "request": "GET /x HTTP/1.1"}`},
+		{line: `{"ts": "1704164645"}`},
+		{line: `{`},
+	}
+	for _, tt := range tests {
+		got, err := parseJSONLog(tt.line, fields)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("parseJSONLog(%q) = %+v, want an error", tt.line, got)
+			}
+			continue
+		}
+		if err != nil || !got.Time.Equal(tt.want.Time) {
+			t.Errorf("parseJSONLog(%q) = %+v, %v, want %+v", tt.line, got, err, tt.want)
+			continue
+		}
+		got.Time = tt.want.Time
+		if got != tt.want {
+			t.Errorf("parseJSONLog(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+
+	for _, s := range []string{"nope=x", "time", "time="} {
+		if _, err := ParseLogFields(s); err == nil {
+			t.Errorf("ParseLogFields(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-01-02T03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02T03:04:05.123+01:00", time.Date(2024, 1, 2, 2, 4, 5, 123e6, time.UTC)},
+		{"02/Jan/2024:03:04:05 +0000", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"2024-01-02 03:04:05.25", time.Date(2024, 1, 2, 3, 4, 5, 25e7, time.UTC)},
+		{"1704164645", time.Unix(1704164645, 0)},
+		{"1704164645.5", time.Unix(1704164645, 5e8)},
+		{"1704164645500", time.Unix(1704164645, 5e8)},
+	}
+	for _, tt := range tests {
+		got, err := parseLogTime(tt.in)
+		if d := got.Sub(tt.want); err != nil || d > time.Millisecond || d < -time.Millisecond {
+			t.Errorf("parseLogTime(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseLogTime("tomorrow"); err == nil {
+		t.Error("parseLogTime(tomorrow) succeeded, want an error")
+	}
+}
@@ -0,0 +1,86 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"ngoperf/pkg/myhttp"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// prime sends req once and returns its header with the
+// If-None-Match and If-Modified-Since fields built from the validators of the response,
+// and the response, which is the full response the 304 responses are compared to
+func (p *Profiler) prime(req *myhttp.Request) (myhttp.Header, *myhttp.Response, error) {
+	client := p.client
+	rc, err := client.Do(req)
+	if client.Conn != nil {
+		client.Conn.Close()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if rc.StatusCode/100 != 2 {
+		return nil, nil, errors.New("The full request to capture the validators returned " + rc.Status)
+	}
+	header := append(myhttp.Header{}, req.Header...)
+	if etag := rc.Header.Get("ETag"); etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified := rc.Header.Get("Last-Modified"); lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+	if len(header) == len(req.Header) {
+		return nil, nil, errors.New("The response has neither ETag nor Last-Modified to revalidate with")
+	}
+	fmt.Print("Revalidating " + req.URL + " with\n" + header[len(req.Header):].String())
+	return header, rc, nil
+}
+
+// revalidationKey groups the revalidation records by status code
+func revalidationKey(rec *myhttp.Response) string {
+	if rec.StatusCode == 0 {
+		return "error"
+	}
+	return strconv.Itoa(rec.StatusCode)
+}
+
+// printRevalidationSummary prints the ratio and TTFB of each status code,
+// and the TTFB percentiles of 304 against 200 responses
+func printRevalidationSummary(groups map[string]*groupResult) {
+	fmt.Println("\nThe Summary of Revalidation by Status Code (TTFB in ms):")
+	keys := []string{}
+	total := 0
+	for k, g := range groups {
+		keys = append(keys, k)
+		total += g.count
+	}
+	sort.Strings(keys)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	header := []string{"status", "requests", "ratio", "fast", "slow", "mean", "median"}
+	table.SetHeader(header)
+	for _, k := range keys {
+		g := groups[k]
+		data := []string{k, prettyInt(g.count), fmt.Sprintf("%.1f %%", float32(g.count)*100/float32(total))}
+		table.Append(append(data, intervalStats(g.ttfb)...))
+	}
+	colors := make([]tablewriter.Colors, len(header))
+	for i := range colors {
+		colors[i] = tablewriter.Colors{tablewriter.Bold}
+	}
+	table.SetHeaderColor(colors...)
+	table.Render()
+
+	compared := map[string]*groupResult{"304": {}, "200": {}}
+	for k := range compared {
+		if g, ok := groups[k]; ok {
+			compared[k] = g
+		}
+	}
+	printPercentileComparison("\nThe Percentiles of Time to First Byte of 304 and 200 Responses (ms):", compared)
+}
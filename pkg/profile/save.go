@@ -0,0 +1,455 @@
+package profile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"ngoperf/pkg/myhttp"
+)
+
+// runFileVersion is the version of the format of the saved runs
+const runFileVersion = 1
+
+// RunMeta is the metadata of a saved profile run
+type RunMeta struct {
+	Version int `json:"version"`
+	// Command is the command line of the run
+	Command  []string      `json:"command"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Host     RunHost       `json:"host"`
+	Targets  []Target      `json:"targets"`
+	Options  Options       `json:"options"`
+	// HTTP10 and ExpectContinue are the client settings the report depends on
+	HTTP10         bool `json:"http10,omitempty"`
+	ExpectContinue bool `json:"expectContinue,omitempty"`
+}
+
+// RunHost is the machine a run was made from
+type RunHost struct {
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	CPUs      int    `json:"cpus"`
+	GoVersion string `json:"goVersion"`
+}
+
+// runRecord is one response of a saved run, with short names as there is one per request
+type runRecord struct {
+	Target int `json:"t"`
+	// At is the start of the request in µs after the start of the run
+	At int64 `json:"at"`
+	// URL is set when the request was sent to another url than its target, e.g. with a data feed
+	URL            string                   `json:"u,omitempty"`
+	Status         string                   `json:"s"`
+	StatusCode     int                      `json:"c,omitempty"`
+	TTFB           int64                    `json:"ttfb"`
+	ResponseSize   int64                    `json:"size,omitempty"`
+	BodySize       int64                    `json:"body,omitempty"`
+	Position       int                      `json:"pos,omitempty"`
+	RemoteAddr     string                   `json:"remote,omitempty"`
+	LocalAddr      string                   `json:"local,omitempty"`
+	Network        string                   `json:"net,omitempty"`
+	Proxy          string                   `json:"proxy,omitempty"`
+	ProxyTime      int64                    `json:"proxyTime,omitempty"`
+	ContinueTime   int64                    `json:"continueTime,omitempty"`
+	ContinueStatus int                      `json:"continueStatus,omitempty"`
+	Interim        []myhttp.InterimResponse `json:"interim,omitempty"`
+	Parts          []myhttp.ContentRange    `json:"parts,omitempty"`
+	RangeMismatch  string                   `json:"rangeMismatch,omitempty"`
+	RangeError     string                   `json:"rangeError,omitempty"`
+	Warnings       []myhttp.Warning         `json:"warnings,omitempty"`
+	TCPInfo        *myhttp.TCPInfo          `json:"tcpInfo,omitempty"`
+	Timings        *myhttp.Timings          `json:"timings,omitempty"`
+	// Upload is set when the request had a body, which is not saved
+	Upload bool `json:"upload,omitempty"`
+}
+
+// unsavedBody is the body of the requests of a loaded run that had one
+var unsavedBody = []byte("(not saved)")
+
+// saveRun writes the metadata and the records of a run to p.Save, as gzipped JSON lines:
+// the metadata first and then one record per line
+func (p *Profiler) saveRun(targets []Target, start time.Time, elapsed time.Duration, recs []record) error {
+	hostname, _ := os.Hostname()
+	meta := RunMeta{
+		Version:  runFileVersion,
+		Start:    start,
+		Duration: elapsed,
+		Host: RunHost{
+			Hostname:  hostname,
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			CPUs:      runtime.NumCPU(),
+			GoVersion: runtime.Version(),
+		},
+		Targets:        make([]Target, len(targets)),
+		Options:        p.Options,
+		HTTP10:         p.client.HTTP10,
+		ExpectContinue: p.client.ExpectContinue,
+	}
+	meta.Options.Save = ""
+	// the run files are shared, so they keep no credentials, and no request body which the report does not need
+	meta.Command = redactCommand(os.Args)
+	meta.Options.Header = redactHeader(p.Header)
+	meta.Options.Body = nil
+	for i, t := range targets {
+		t.URL = redactURL(t.URL)
+		t.Header = redactHeader(t.Header)
+		t.Body = nil
+		meta.Targets[i] = t
+	}
+
+	file, err := os.Create(p.Save)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	zw := gzip.NewWriter(file)
+	enc := json.NewEncoder(zw)
+	if err = enc.Encode(meta); err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if err = enc.Encode(newRunRecord(rec, targets, start)); err != nil {
+			return err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// redacted replaces the credentials in the saved runs
+const redacted = "REDACTED"
+
+// secretFlags are the flags whose values are credentials
+var secretFlags = map[string]bool{"--user": true, "--bearer": true, "--aws-sigv4": true}
+
+// redactCommand returns a copy of the command line with the values of secretFlags and the bodies replaced,
+// and the urls and header fields redacted with redactURL and redactHeaderLine
+func redactCommand(args []string) []string {
+	out := append([]string{}, args...)
+	for i := 0; i < len(out); i++ {
+		name, value, inline := out[i], "", false
+		if j := strings.IndexByte(name, '='); j > 0 && strings.HasPrefix(name, "--") {
+			name, value, inline = name[:j], name[j+1:], true
+		} else if len(name) > 2 && name[0] == '-' && strings.IndexByte("Hdux", name[1]) >= 0 {
+			// a short flag with its value attached, e.g. -HCookie:a=b
+			name, value, inline = name[:2], name[2:], true
+		}
+		var redact func(string) string
+		switch {
+		case secretFlags[name]:
+			redact = func(string) string { return redacted }
+		case name == "-H" || name == "--header":
+			redact = redactHeaderLine
+		case name == "-d" || name == "--data":
+			redact = redactBody
+		case inline:
+			redact = redactURL
+		default:
+			// the urls are given as values of -u, --proxy or as arguments
+			out[i] = redactURL(out[i])
+			continue
+		}
+		if inline {
+			sep := "="
+			if !strings.HasPrefix(name, "--") {
+				sep = ""
+			}
+			out[i] = name + sep + redact(value)
+		} else if i+1 < len(out) {
+			i++
+			out[i] = redact(out[i])
+		}
+	}
+	return out
+}
+
+// secretName reports whether the values of the header field or query parameter are credentials,
+// like Authorization, Cookie or an API key
+func secretName(name string) bool {
+	name = strings.ToLower(name)
+	if name == "cookie" || name == "set-cookie" {
+		return true
+	}
+	for _, s := range []string{"auth", "key", "token", "secret", "password", "session", "signature"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeader returns a copy of the header with the values of the fields with credentials replaced
+func redactHeader(h myhttp.Header) myhttp.Header {
+	if h == nil {
+		return nil
+	}
+	out := make(myhttp.Header, len(h))
+	for i, f := range h {
+		if secretName(f.Name) {
+			f.Value = redacted
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// redactHeaderLine replaces the value of a "name: value" header field with credentials
+func redactHeaderLine(line string) string {
+	i := strings.IndexByte(line, ':')
+	if i < 0 || !secretName(strings.TrimSpace(line[:i])) {
+		return line
+	}
+	return line[:i] + ": " + redacted
+}
+
+// redactBody replaces a body given on the command line, but not the name of a @file
+func redactBody(body string) string {
+	if strings.HasPrefix(body, "@") {
+		return body
+	}
+	return redacted
+}
+
+// redactURL removes the user and password of a url and replaces the values of the query parameters
+// with credentials, s is returned as it is if it is not a url or has neither
+func redactURL(s string) string {
+	scheme := ""
+	if !strings.Contains(s, "://") {
+		// the urls may have no scheme
+		scheme = "https://"
+	}
+	u, err := url.Parse(scheme + s)
+	if err != nil || u.Host == "" {
+		return s
+	}
+	redactedURL := u.User != nil
+	u.User = nil
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		name := param
+		if j := strings.IndexByte(param, '='); j >= 0 {
+			name = param[:j]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil && secretName(unescaped) {
+			params[i] = name + "=" + redacted
+			redactedURL = true
+		}
+	}
+	if !redactedURL {
+		return s
+	}
+	u.RawQuery = strings.Join(params, "&")
+	return strings.TrimPrefix(u.String(), scheme)
+}
+
+func newRunRecord(rec record, targets []Target, start time.Time) *runRecord {
+	rc := rec.Response
+	r := &runRecord{
+		Target:         rec.target,
+		Status:         rc.Status,
+		StatusCode:     rc.StatusCode,
+		TTFB:           rc.TTFB,
+		ResponseSize:   rc.ResponseSize,
+		BodySize:       rc.BodySize,
+		Position:       rc.Position,
+		RemoteAddr:     rc.RemoteAddr,
+		LocalAddr:      rc.LocalAddr,
+		Network:        rc.Network,
+		Proxy:          rc.Proxy,
+		ProxyTime:      rc.ProxyTime,
+		ContinueTime:   rc.ContinueTime,
+		ContinueStatus: rc.ContinueStatus,
+		Parts:          rc.Parts,
+		RangeMismatch:  rc.RangeMismatch,
+		RangeError:     rc.RangeError,
+		Warnings:       rc.Warnings,
+		TCPInfo:        rc.TCPInfo,
+		Upload:         hasBody(rc.Request),
+	}
+	if !rc.StartTime().IsZero() {
+		r.At = rc.StartTime().Sub(start).Microseconds()
+	}
+	if rc.Request != nil && rc.Request.URL != targets[rec.target].URL {
+		r.URL = redactURL(rc.Request.URL)
+	}
+	if rc.StatusCode > 0 {
+		r.Timings = &rc.Timings
+	}
+	// the header of the 1xx responses is not kept
+	for _, interim := range rc.Interim {
+		r.Interim = append(r.Interim, myhttp.InterimResponse{Status: interim.Status, StatusCode: interim.StatusCode, Time: interim.Time})
+	}
+	return r
+}
+
+// response returns the record as a response to the target request
+func (r *runRecord) response(targets []Target, method string) *myhttp.Response {
+	t := targets[r.Target]
+	req := &myhttp.Request{Method: t.Method, URL: t.URL}
+	if req.Method == "" {
+		req.Method = method
+	}
+	if r.URL != "" {
+		req.URL = r.URL
+	}
+	if r.Upload {
+		req.Body = unsavedBody
+	}
+	rc := &myhttp.Response{
+		Request:        req,
+		Status:         r.Status,
+		StatusCode:     r.StatusCode,
+		TTFB:           r.TTFB,
+		ResponseSize:   r.ResponseSize,
+		BodySize:       r.BodySize,
+		Position:       r.Position,
+		RemoteAddr:     r.RemoteAddr,
+		LocalAddr:      r.LocalAddr,
+		Network:        r.Network,
+		Proxy:          r.Proxy,
+		ProxyTime:      r.ProxyTime,
+		ContinueTime:   r.ContinueTime,
+		ContinueStatus: r.ContinueStatus,
+		Interim:        r.Interim,
+		Parts:          r.Parts,
+		RangeMismatch:  r.RangeMismatch,
+		RangeError:     r.RangeError,
+		Warnings:       r.Warnings,
+		TCPInfo:        r.TCPInfo,
+	}
+	if r.Timings != nil {
+		rc.Timings = *r.Timings
+	}
+	return rc
+}
+
+// SavedRun is a profile run read back from a file written with Options.Save
+type SavedRun struct {
+	// Name is the file the run was read from
+	Name    string
+	Meta    RunMeta
+	records []record
+	// at are the start times of the records in µs after the start of the run
+	at []int64
+}
+
+// LoadRun reads a run saved with Options.Save
+func LoadRun(name string) (*SavedRun, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a saved run: %s", name, err.Error())
+	}
+	dec := json.NewDecoder(zr)
+	run := &SavedRun{Name: name}
+	if err = dec.Decode(&run.Meta); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	if run.Meta.Version != runFileVersion {
+		return nil, fmt.Errorf("%s: unsupported version %d", name, run.Meta.Version)
+	}
+	if len(run.Meta.Targets) == 0 {
+		return nil, fmt.Errorf("%s: no target", name)
+	}
+	for n := 2; dec.More(); n++ {
+		r := &runRecord{}
+		if err = dec.Decode(r); err != nil {
+			return nil, fmt.Errorf("%s: record %d: %s", name, n, err.Error())
+		}
+		if r.Target < 0 || r.Target >= len(run.Meta.Targets) {
+			return nil, fmt.Errorf("%s: record %d: invalid target %d", name, n, r.Target)
+		}
+		run.records = append(run.records, record{target: r.Target, Response: r.response(run.Meta.Targets, run.Meta.Options.Method)})
+		run.at = append(run.at, r.At)
+	}
+	return run, nil
+}
+
+// The output formats of Report
+const (
+	FormatTable = "table"
+	FormatCSV   = "csv"
+	FormatJSON  = "json"
+)
+
+// Report prints the run in the format: the tables of the profile command,
+// or one CSV line or JSON object per request
+func (run *SavedRun) Report(format string) error {
+	switch format {
+	case FormatTable:
+		run.printMeta()
+		p := &Profiler{Options: run.Meta.Options, client: myhttp.Client{HTTP10: run.Meta.HTTP10, ExpectContinue: run.Meta.ExpectContinue}}
+		p.report(run.Meta.Targets, run.records)
+		return nil
+	case FormatCSV:
+		return run.writeCSV()
+	case FormatJSON:
+		return run.writeJSON()
+	}
+	return errors.New("Invalid format, want table, csv or json: " + format)
+}
+
+func (run *SavedRun) printMeta() {
+	m := run.Meta
+	fmt.Printf("Run of %s requests with %d workers, started %s and lasting %s\n",
+		prettyInt(len(run.records)), m.Options.NumWorker, m.Start.Format(time.RFC3339), m.Duration.Round(time.Millisecond))
+	fmt.Printf("From %s (%s/%s, %d CPUs, %s)\n", m.Host.Hostname, m.Host.OS, m.Host.Arch, m.Host.CPUs, m.Host.GoVersion)
+	if len(m.Command) > 0 {
+		fmt.Printf("Command: %s\n", strings.Join(m.Command, " "))
+	}
+}
+
+var csvHeader = []string{"target", "method", "url", "start_us", "status_code", "status", "ttfb_ms", "size", "body_size",
+	"position", "remote_addr", "local_addr", "dns_us", "connect_us", "tls_us", "send_us", "wait_us", "receive_us"}
+
+func (run *SavedRun) writeCSV() error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write(csvHeader)
+	us := func(d time.Duration) string { return strconv.FormatInt(d.Microseconds(), 10) }
+	for i, rec := range run.records {
+		rc := rec.Response
+		t := rc.Timings
+		w.Write([]string{
+			strconv.Itoa(rec.target), rc.Request.Method, rc.Request.URL, strconv.FormatInt(run.at[i], 10),
+			strconv.Itoa(rc.StatusCode), rc.Status, strconv.FormatInt(rc.TTFB, 10), strconv.FormatInt(rc.ResponseSize, 10),
+			strconv.FormatInt(rc.BodySize, 10), strconv.Itoa(rc.Position), rc.RemoteAddr, rc.LocalAddr,
+			us(t.DNS), us(t.Connect), us(t.TLS), us(t.Send), us(t.Wait), us(t.Receive),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeJSON prints the metadata and the records as one JSON object
+func (run *SavedRun) writeJSON() error {
+	out := struct {
+		Meta    RunMeta      `json:"meta"`
+		Records []*runRecord `json:"records"`
+	}{Meta: run.Meta, Records: make([]*runRecord, len(run.records))}
+	for i, rec := range run.records {
+		out.Records[i] = newRunRecord(rec, run.Meta.Targets, time.Time{})
+		out.Records[i].At = run.at[i]
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,462 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ngoperf/pkg/myhttp"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v2"
+)
+
+// Scenario is a flow of steps every virtual user runs in turn, loaded from a YAML or JSON file
+type Scenario struct {
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// BaseURL is prepended to the step urls starting with /
+	BaseURL string `yaml:"base_url,omitempty" json:"base_url,omitempty"`
+	// Users is the number of virtual users, each running Iterations times the steps
+	Users      int `yaml:"users,omitempty" json:"users,omitempty"`
+	Iterations int `yaml:"iterations,omitempty" json:"iterations,omitempty"`
+	// ThinkTime is the pause before each step but the first, a duration like 1s or a range like 1s-3s
+	ThinkTime string `yaml:"think_time,omitempty" json:"think_time,omitempty"`
+	// Variables are the initial values of the {{name}} placeholders
+	Variables map[string]string `yaml:"variables,omitempty" json:"variables,omitempty"`
+	Steps     []Step            `yaml:"steps" json:"steps"`
+}
+
+// Step is one request of a scenario, {{name}} in its url, headers and body is replaced by the variable
+type Step struct {
+	Name    string            `yaml:"name,omitempty" json:"name,omitempty"`
+	Method  string            `yaml:"method,omitempty" json:"method,omitempty"`
+	URL     string            `yaml:"url" json:"url"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty" json:"body,omitempty"`
+	// ThinkTime overrides the think time of the scenario before the step
+	ThinkTime string `yaml:"think_time,omitempty" json:"think_time,omitempty"`
+	// Repeat is the number of times the step is sent, 1 if not set
+	Repeat int `yaml:"repeat,omitempty" json:"repeat,omitempty"`
+	// ExpectStatus is the status code the step must return, any code below 400 if not set
+	ExpectStatus int `yaml:"expect_status,omitempty" json:"expect_status,omitempty"`
+	// Capture sets variables from the response for the next steps
+	Capture []Capture `yaml:"capture,omitempty" json:"capture,omitempty"`
+
+	thinkMin, thinkMax time.Duration
+	regexps            []*regexp.Regexp
+}
+
+// Capture sets the variable Name from a response header, the body matched by a regular expression,
+// or a JSON path of the body like items.0.id
+// With Header and Regex, the expression is matched against the header value
+// The first group of the expression is captured, or the whole match if it has no group
+type Capture struct {
+	Name   string `yaml:"name" json:"name"`
+	Header string `yaml:"header,omitempty" json:"header,omitempty"`
+	Regex  string `yaml:"regex,omitempty" json:"regex,omitempty"`
+	JSON   string `yaml:"json,omitempty" json:"json,omitempty"`
+}
+
+// LoadScenario reads and checks a scenario file, JSON files are read as YAML
+func LoadScenario(name string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	sc := &Scenario{}
+	if err = yaml.UnmarshalStrict(data, sc); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	if err = sc.check(); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	return sc, nil
+}
+
+func (sc *Scenario) check() error {
+	if len(sc.Steps) == 0 {
+		return errors.New("no steps")
+	}
+	if sc.Users <= 0 {
+		sc.Users = 1
+	}
+	if sc.Iterations <= 0 {
+		sc.Iterations = 1
+	}
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		if step.URL == "" {
+			return fmt.Errorf("step %d has no url", i+1)
+		}
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("%d %s", i+1, step.URL)
+		}
+		if step.Method == "" {
+			step.Method = "GET"
+			if step.Body != "" {
+				step.Method = "POST"
+			}
+		}
+		step.Method = strings.ToUpper(step.Method)
+		if step.Repeat <= 0 {
+			step.Repeat = 1
+		}
+		think := sc.ThinkTime
+		if step.ThinkTime != "" {
+			think = step.ThinkTime
+		}
+		var err error
+		if step.thinkMin, step.thinkMax, err = parseThinkTime(think); err != nil {
+			return fmt.Errorf("step %s: %s", step.Name, err.Error())
+		}
+		step.regexps = make([]*regexp.Regexp, len(step.Capture))
+		for j, c := range step.Capture {
+			sources := 0
+			for _, s := range []string{c.Header, c.JSON} {
+				if s != "" {
+					sources++
+				}
+			}
+			if c.Regex != "" && c.Header == "" {
+				sources++
+			}
+			if c.Name == "" || sources != 1 {
+				return fmt.Errorf("step %s: a capture needs a name and one of header, regex or json", step.Name)
+			}
+			if c.Regex != "" {
+				if step.regexps[j], err = regexp.Compile(c.Regex); err != nil {
+					return fmt.Errorf("step %s: %s", step.Name, err.Error())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the scenario to a YAML file, or to the standard output if name is -
+func (sc *Scenario) Save(name string) error {
+	data, err := yaml.Marshal(sc)
+	if err != nil {
+		return err
+	}
+	if name == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// Targets returns one profile target per step with its method, headers and body, weighted by its repeat
+// The {{name}} placeholders are replaced by the variables of the scenario
+func (sc *Scenario) Targets() []Target {
+	targets := make([]Target, len(sc.Steps))
+	for i := range sc.Steps {
+		step := &sc.Steps[i]
+		req := step.request(sc.BaseURL, sc.Variables)
+		targets[i] = Target{URL: req.URL, Method: req.Method, Weight: step.Repeat, Header: req.Header, Body: req.Body, ExactPath: true}
+		if targets[i].Weight <= 0 {
+			targets[i].Weight = 1
+		}
+	}
+	return targets
+}
+
+// parseThinkTime parses a duration like 1s or a range like 500ms-2s
+func parseThinkTime(s string) (min, max time.Duration, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(s, "-", 2)
+	if min, err = time.ParseDuration(strings.TrimSpace(parts[0])); err != nil {
+		return 0, 0, errors.New("invalid think time " + s)
+	}
+	max = min
+	if len(parts) == 2 {
+		if max, err = time.ParseDuration(strings.TrimSpace(parts[1])); err != nil || max < min {
+			return 0, 0, errors.New("invalid think time " + s)
+		}
+	}
+	return min, max, nil
+}
+
+func (step *Step) think(r *rand.Rand) time.Duration {
+	if step.thinkMax <= step.thinkMin {
+		return step.thinkMin
+	}
+	return step.thinkMin + time.Duration(r.Int63n(int64(step.thinkMax-step.thinkMin)))
+}
+
+// needsBody reports whether the captures of the step read the response body
+func (step *Step) needsBody() bool {
+	for _, c := range step.Capture {
+		if c.Header == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// stepResult is the result of the requests of one step
+type stepResult struct {
+	requests int
+	ok       int
+	// failed counts the responses with an unexpected status or a failed capture, errors the requests with no response
+	failed int
+	errors int
+	ttfb   []int64
+}
+
+// scenarioResult is the result of a scenario run, shared by the users
+type scenarioResult struct {
+	mu    sync.Mutex
+	all   *profileResult
+	steps []stepResult
+	// failures counts the failed steps by step and reason
+	failures map[string]int
+	// durations are the times in ms of the completed iterations without the think times
+	durations []int64
+	completed int
+	aborted   int
+}
+
+// RunScenario runs the scenario with one goroutine per user, each user has its own cookie jar,
+// started from a copy of the jar of the client and merged back at the end, and its own copy of the variables
+// An iteration stops at its first failed step
+func (p *Profiler) RunScenario(sc *Scenario) {
+	if p.Feed != nil {
+		if err := p.Feed.Check(sc.Users * sc.Iterations); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	result := &scenarioResult{all: newProfileResult(), steps: make([]stepResult, len(sc.Steps)), failures: make(map[string]int)}
+	bar := pb.StartNew(sc.Users * sc.Iterations)
+	var jars []*myhttp.CookieJar
+	var wg sync.WaitGroup
+	for i := 0; i < sc.Users; i++ {
+		wg.Add(1)
+		client := p.client
+		if p.client.Jar != nil {
+			client.Jar = p.client.Jar.Clone()
+		} else {
+			client.Jar = myhttp.NewCookieJar()
+		}
+		jars = append(jars, client.Jar)
+		seed := time.Now().UnixNano() + int64(i)
+		go func() {
+			defer wg.Done()
+			p.runUser(&client, sc, result, bar, rand.New(rand.NewSource(seed)))
+		}()
+	}
+	wg.Wait()
+	bar.Finish()
+	if p.client.Jar != nil {
+		for _, jar := range jars {
+			p.client.Jar.Merge(jar)
+		}
+	}
+
+	name := sc.Name
+	if name == "" {
+		name = "scenario"
+	}
+	fmt.Printf("\n=== %s (%d users, %d iterations) ===\n", name, sc.Users, sc.Iterations)
+	printStepSummary(sc, result)
+	if len(result.failures) > 0 {
+		printCountSummary("\nThe Step Failures:", "step: reason", result.failures)
+	}
+	printIterationSummary(result)
+	fmt.Println("\n=== All Requests ===")
+	printProfileResults(result.all, sc.BaseURL)
+	if len(result.all.fatalError) > 0 {
+		printErrors(result.all)
+	}
+}
+
+func (p *Profiler) runUser(client *myhttp.Client, sc *Scenario, result *scenarioResult, bar *pb.ProgressBar, r *rand.Rand) {
+	vars := make(map[string]string, len(sc.Variables))
+	for k, v := range sc.Variables {
+		vars[k] = v
+	}
+	for it := 0; it < sc.Iterations; it++ {
+		// each iteration takes the next row of the feed, its columns replace the variables of the same name
+		if p.Feed != nil {
+			row, _ := p.Feed.Next()
+			for k, v := range row {
+				vars[k] = v
+			}
+		}
+		var elapsed time.Duration
+		completed := true
+		for i := range sc.Steps {
+			step := &sc.Steps[i]
+			if i > 0 {
+				time.Sleep(step.think(r))
+			}
+			start := time.Now()
+			ok := p.runStep(client, sc, i, vars, result)
+			elapsed += time.Since(start)
+			if !ok {
+				completed = false
+				break
+			}
+		}
+		result.mu.Lock()
+		if completed {
+			result.completed++
+			result.durations = append(result.durations, elapsed.Milliseconds())
+		} else {
+			result.aborted++
+		}
+		result.mu.Unlock()
+		bar.Increment()
+	}
+}
+
+// runStep sends the requests of step i and sets the captured variables, it reports whether the step succeeded
+func (p *Profiler) runStep(client *myhttp.Client, sc *Scenario, i int, vars map[string]string, result *scenarioResult) bool {
+	step := &sc.Steps[i]
+	client.Body = ioutil.Discard
+	if step.needsBody() {
+		client.Body = nil
+	}
+	for n := 0; n < step.Repeat; n++ {
+		req := step.request(sc.BaseURL, vars)
+		// the header fields of the step replace the ones of the options
+		for _, f := range p.Header {
+			if req.Header.Get(f.Name) == "" {
+				req.Header.Add(f.Name, f.Value)
+			}
+		}
+		rc, err := client.Do(req)
+		if client.Conn != nil {
+			client.Conn.Close()
+		}
+		reason := ""
+		if err != nil {
+			if client.Verbose {
+				fmt.Printf("%s rerror %s: %s\n", req.Method, req.URL, err.Error())
+			}
+			rc = &myhttp.Response{Request: req, Status: err.Error(), RemoteAddr: client.IP}
+			reason = "error"
+		} else if !step.expected(rc.StatusCode) {
+			reason = "status " + rc.Status
+		} else {
+			for j := range step.Capture {
+				c := &step.Capture[j]
+				v, err := c.capture(step.regexps[j], rc)
+				if err != nil {
+					reason = "capture " + c.Name + ": " + err.Error()
+					break
+				}
+				if client.Verbose {
+					fmt.Printf("Captured %s = %s\n", c.Name, v)
+				}
+				vars[c.Name] = v
+			}
+		}
+
+		result.mu.Lock()
+		result.all.add(p, rc)
+		sr := &result.steps[i]
+		sr.requests++
+		switch {
+		case err != nil:
+			sr.errors++
+		case reason != "":
+			sr.failed++
+		default:
+			sr.ok++
+		}
+		if err == nil {
+			sr.ttfb = append(sr.ttfb, rc.TTFB)
+		}
+		if reason != "" {
+			result.failures[step.Name+": "+reason]++
+		}
+		result.mu.Unlock()
+		if reason != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// request returns the request of the step with the variables expanded
+func (step *Step) request(baseURL string, vars map[string]string) *myhttp.Request {
+	reqURL := expandURL(step.URL, vars)
+	if strings.HasPrefix(reqURL, "/") {
+		reqURL = strings.TrimSuffix(baseURL, "/") + reqURL
+	}
+	req := &myhttp.Request{Method: step.Method, URL: reqURL}
+	names := make([]string, 0, len(step.Headers))
+	for name := range step.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		req.Header.Add(name, expand(step.Headers[name], vars))
+	}
+	if step.Body != "" {
+		req.Body = []byte(expand(step.Body, vars))
+	}
+	return req
+}
+
+// expected reports whether the status code is the one the step expects
+func (step *Step) expected(statusCode int) bool {
+	if step.ExpectStatus != 0 {
+		return statusCode == step.ExpectStatus
+	}
+	return statusCode > 0 && statusCode < 400
+}
+
+// printStepSummary prints one row per step in the order of the scenario
+func printStepSummary(sc *Scenario, result *scenarioResult) {
+	fmt.Println("\nThe Summary by Step (TTFB in ms):")
+	table := tablewriter.NewWriter(os.Stdout)
+	header := []string{"step", "requests", "ok", "failed", "errors", "fast", "slow", "mean", "median"}
+	table.SetHeader(header)
+	table.SetAutoWrapText(false)
+	for i, step := range sc.Steps {
+		sr := result.steps[i]
+		data := []string{step.Name, prettyInt(sr.requests), prettyInt(sr.ok), prettyInt(sr.failed), prettyInt(sr.errors)}
+		data = append(data, intervalStats(sr.ttfb)...)
+		if sr.ok < sr.requests {
+			table.Rich(data, []tablewriter.Colors{{}, {}, {}, {tablewriter.BgRedColor}})
+		} else {
+			table.Append(data)
+		}
+	}
+	colors := make([]tablewriter.Colors, len(header))
+	for i := range colors {
+		colors[i] = tablewriter.Colors{tablewriter.Bold}
+	}
+	table.SetHeaderColor(colors...)
+	table.Render()
+}
+
+// printIterationSummary prints the number of completed and failed iterations
+// and the durations of the completed ones
+func printIterationSummary(result *scenarioResult) {
+	fmt.Println("\nThe Summary of Iterations (duration in ms without think time):")
+	table := tablewriter.NewWriter(os.Stdout)
+	header := []string{"iterations", "completed", "failed", "fast", "slow", "mean", "median"}
+	table.SetHeader(header)
+	data := []string{prettyInt(result.completed + result.aborted), prettyInt(result.completed), prettyInt(result.aborted)}
+	table.Append(append(data, intervalStats(result.durations)...))
+	colors := make([]tablewriter.Colors, len(header))
+	for i := range colors {
+		colors[i] = tablewriter.Colors{tablewriter.Bold}
+	}
+	table.SetHeaderColor(colors...)
+	table.Render()
+}
@@ -0,0 +1,59 @@
+package profile
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"ngoperf/pkg/myhttp"
+)
+
+// ipSpreader picks the address of the host for each request,
+// in turn with mode "rr" or at random with mode "random"
+type ipSpreader struct {
+	mu         sync.Mutex
+	reqURL     string
+	random     bool
+	perRequest bool
+	ips        []string
+	i          int
+	rand       *rand.Rand
+}
+
+func newIPSpreader(client *myhttp.Client, reqURL string, mode string, perRequest bool) (*ipSpreader, error) {
+	if mode != "rr" && mode != "random" {
+		return nil, errors.New("Invalid spread-ips mode, want rr or random: " + mode)
+	}
+	s := &ipSpreader{
+		reqURL:     reqURL,
+		random:     mode == "random",
+		perRequest: perRequest,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	var err error
+	if s.ips, err = client.LookupIPs(reqURL); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// next returns the address for the next request
+// If the host is resolved per request and the lookup fails, the last addresses are used
+func (s *ipSpreader) next(client *myhttp.Client) string {
+	var ips []string
+	if s.perRequest {
+		ips, _ = client.LookupIPs(s.reqURL)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(ips) > 0 {
+		s.ips = ips
+	}
+	if s.random {
+		return s.ips[s.rand.Intn(len(s.ips))]
+	}
+	s.i = (s.i + 1) % len(s.ips)
+	return s.ips[s.i]
+}
@@ -0,0 +1,131 @@
+package profile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"ngoperf/pkg/myhttp"
+)
+
+// Target is one url of a profile run with the share of the requests sent to it
+type Target struct {
+	URL string
+	// Method overrides Options.Method if set
+	Method string
+	// Weight is the relative share of the requests, 1 if not set
+	Weight int
+	// Header is sent after Options.Header, replacing its fields of the same name
+	Header myhttp.Header
+	// Body replaces Options.Body if set
+	Body []byte
+	// ExactPath sends the path as it is, without the "/" appended to the path of a bare url, see myhttp.Request.SlashPath
+	ExactPath bool
+}
+
+func (t Target) String() string {
+	if t.Method == "" {
+		return t.URL
+	}
+	return t.Method + " " + t.URL
+}
+
+// LoadTargets reads a url file with one "[METHOD] url [weight]" per line
+// Empty lines and lines starting with # are skipped
+func LoadTargets(name string) ([]Target, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var targets []Target
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		t := Target{Weight: 1}
+		if len(fields) > 1 && isMethod(fields[0]) {
+			t.Method, fields = fields[0], fields[1:]
+		}
+		if len(fields) > 1 {
+			if t.Weight, err = strconv.Atoi(fields[len(fields)-1]); err != nil || t.Weight <= 0 {
+				return nil, fmt.Errorf("%s:%d: invalid weight %s, want a positive integer", name, n, fields[len(fields)-1])
+			}
+			fields = fields[:len(fields)-1]
+		}
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("%s:%d: want [METHOD] url [weight]", name, n)
+		}
+		t.URL = fields[0]
+		targets = append(targets, t)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("No url in " + name)
+	}
+	return targets, nil
+}
+
+// isMethod reports whether s is an upper case method name like GET
+func isMethod(s string) bool {
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// targetHost returns the host of the target url, which may have no scheme
+func targetHost(reqURL string) string {
+	if !strings.Contains(reqURL, "://") {
+		reqURL = "https://" + reqURL
+	}
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return reqURL
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// targetPicker picks the targets by weight with the smooth weighted round-robin of nginx,
+// so each target gets its exact share and the picks of a target are spread evenly
+type targetPicker struct {
+	weights []int
+	current []int
+	total   int
+}
+
+func newTargetPicker(targets []Target) *targetPicker {
+	tp := &targetPicker{weights: make([]int, len(targets)), current: make([]int, len(targets))}
+	for i, t := range targets {
+		tp.weights[i] = t.Weight
+		if tp.weights[i] <= 0 {
+			tp.weights[i] = 1
+		}
+		tp.total += tp.weights[i]
+	}
+	return tp
+}
+
+// next returns the index of the next target
+func (tp *targetPicker) next() int {
+	best := 0
+	for i, w := range tp.weights {
+		tp.current[i] += w
+		if tp.current[i] > tp.current[best] {
+			best = i
+		}
+	}
+	tp.current[best] -= tp.total
+	return best
+}